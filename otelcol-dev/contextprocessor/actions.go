@@ -3,6 +3,9 @@ package contextprocessor
 import (
 	"context"
 	"fmt"
+	"maps"
+	"strings"
+	"time"
 
 	"go.opentelemetry.io/collector/client"
 	"go.opentelemetry.io/collector/pdata/pcommon"
@@ -14,6 +17,25 @@ type eventContext struct {
 	cliInfo       client.Info
 	resourceAttrs pcommon.Map
 	newMetadata   map[string][]string
+	// metadataShared is set when newMetadata is the one of a cache entry or
+	// of the resource copied, it is copied before it is changed
+	metadataShared bool
+	// sourceValues are the values of the sources inside the resource
+	sourceValues sourceValues
+	// aliases are the other names of the attributes
+	aliases *attributeAliases
+	// limits are applied to the keys set
+	limits *metadataLimiter
+	// fanOutKeys are split in a context for each of their values
+	fanOutKeys []string
+	// resourceCopied is set when the attributes are the ones of a copy of
+	// the resource, changed by the copy actions
+	resourceCopied bool
+	// expires is the earliest expiry of the tokens read by the actions, zero
+	// if none
+	expires time.Time
+	// err is set by the actions when the data has to be dropped or rejected
+	err error
 }
 
 // `NewEventContext` constructs an empty EventContext
@@ -37,9 +59,31 @@ func createEventContext(ctx context.Context, attrs pcommon.Map) *eventContext {
 	}
 }
 
+// attrNames returns the names of the attribute, with the aliases in order of
+// preference
+func (exc *eventContext) attrNames(key string) []string {
+	if exc.aliases == nil {
+		return []string{key}
+	}
+	return exc.aliases.names(key, exc.sourceValues.schemaURL)
+}
+
+// getAttr returns the attribute, or the first alias present
+func (exc *eventContext) getAttr(key string) (pcommon.Value, bool) {
+	if exc.aliases == nil {
+		return exc.resourceAttrs.Get(key)
+	}
+	for _, name := range exc.attrNames(key) {
+		if v, exists := exc.resourceAttrs.Get(name); exists {
+			return v, true
+		}
+	}
+	return pcommon.Value{}, false
+}
+
 func (exc *eventContext) getAttrKey(key, def string) (string, bool) {
 	value := def
-	v, exists := exc.resourceAttrs.Get(key)
+	v, exists := exc.getAttr(key)
 	if exists {
 		switch v.Type() {
 		case pcommon.ValueTypeStr:
@@ -51,8 +95,39 @@ func (exc *eventContext) getAttrKey(key, def string) (string, bool) {
 	return value, exists
 }
 
+// getAttrValues returns the elements of a slice attribute, or the value of
+// any other type of attribute
+func (exc *eventContext) getAttrValues(key string) ([]string, bool) {
+	v, exists := exc.getAttr(key)
+	if !exists {
+		return nil, false
+	}
+	if v.Type() != pcommon.ValueTypeSlice {
+		value, _ := exc.getAttrKey(key, "")
+		return []string{value}, true
+	}
+	values := make([]string, 0, v.Slice().Len())
+	for i := 0; i < v.Slice().Len(); i++ {
+		values = append(values, v.Slice().At(i).AsString())
+	}
+	return values, true
+}
+
+// delAttrKey removes the attribute, and its aliases, from the resource
+func (exc *eventContext) delAttrKey(key string) {
+	for _, name := range exc.attrNames(key) {
+		exc.resourceAttrs.Remove(name)
+	}
+}
+
+// canonicalKey returns the form of the metadata keys, they are case-insensitive
+// and gRPC only supports lowercase keys
+func canonicalKey(key string) string {
+	return strings.ToLower(key)
+}
+
 func (exc *eventContext) getContextKey(key string) ([]string, bool) {
-	if v, exists := exc.newMetadata[key]; exists {
+	if v, exists := exc.newMetadata[canonicalKey(key)]; exists {
 		return v, exists
 	} else {
 		value := exc.cliInfo.Metadata.Get(key)
@@ -63,11 +138,127 @@ func (exc *eventContext) getContextKey(key string) ([]string, bool) {
 func (exc *eventContext) delContextKey(key string) {
 	// Warning: when delete a key is only deleted from newMetadata
 	// so it is available again from the actual metadata
-	delete(exc.newMetadata, key)
+	exc.ownMetadata()
+	delete(exc.newMetadata, canonicalKey(key))
+}
+
+// expireAt keeps the earliest expiry of the values read
+func (exc *eventContext) expireAt(expiry time.Time) {
+	if !expiry.IsZero() && (exc.expires.IsZero() || expiry.Before(exc.expires)) {
+		exc.expires = expiry
+	}
+}
+
+// ownMetadata copies the metadata before it is changed, if it is shared
+func (exc *eventContext) ownMetadata() {
+	if exc.metadataShared {
+		exc.newMetadata = maps.Clone(exc.newMetadata)
+		exc.metadataShared = false
+	}
+}
+
+// setContextKey sets the key, returns false if it is not set because of the limits
+func (exc *eventContext) setContextKey(key string, value []string) bool {
+	return exc.setKey(canonicalKey(key), value, exc.isFanOutKey(canonicalKey(key)))
+}
+
+// setKey sets the key within the limits
+func (exc *eventContext) setKey(key string, values []string, fanOut bool) bool {
+	if exc.limits != nil {
+		var ok bool
+		if values, ok = exc.limits.apply(exc, key, values, fanOut); !ok {
+			return false
+		}
+	}
+	exc.ownMetadata()
+	exc.newMetadata[key] = values
+	return true
+}
+
+// setFanOutKey sets the values of a key which is split in several contexts
+func (exc *eventContext) setFanOutKey(key string, values []string) bool {
+	key = canonicalKey(key)
+	if !exc.setKey(key, values, true) {
+		return false
+	}
+	if !exc.isFanOutKey(key) {
+		exc.fanOutKeys = append(exc.fanOutKeys, key)
+	}
+	return true
+}
+
+func (exc *eventContext) isFanOutKey(key string) bool {
+	for _, k := range exc.fanOutKeys {
+		if k == key {
+			return true
+		}
+	}
+	return false
+}
+
+// splitMetadata returns the metadata for each combination of values of the
+// fan out keys, or just the metadata if there are no fan out keys
+func (exc *eventContext) splitMetadata() []map[string][]string {
+	combinations := []map[string][]string{exc.newMetadata}
+	for _, key := range exc.fanOutKeys {
+		// The final values, other actions could have changed them
+		values := exc.newMetadata[key]
+		if len(values) <= 1 {
+			continue
+		}
+		next := make([]map[string][]string, 0, len(combinations)*len(values))
+		for _, metadata := range combinations {
+			for _, value := range values {
+				md := make(map[string][]string, len(metadata))
+				for k, v := range metadata {
+					md[k] = v
+				}
+				md[key] = []string{value}
+				next = append(next, md)
+			}
+		}
+		combinations = next
+	}
+	return combinations
+}
+
+// copyWith returns an EventContext for a copy of the resource with its own metadata
+func (exc *eventContext) copyWith(metadata map[string][]string) *eventContext {
+	return &eventContext{
+		ctx:           exc.ctx,
+		cliInfo:       exc.cliInfo,
+		resourceAttrs: exc.resourceAttrs,
+		newMetadata:   metadata,
+		limits:        exc.limits,
+	}
+}
+
+// withKey returns a copy of the EventContext for other data of the resource,
+// with a single value in the key
+func (exc *eventContext) withKey(ctx context.Context, attrs pcommon.Map, key, value string) *eventContext {
+	metadata := make(map[string][]string, len(exc.newMetadata)+1)
+	for k, v := range exc.newMetadata {
+		metadata[k] = v
+	}
+	metadata[canonicalKey(key)] = []string{value}
+	return &eventContext{
+		ctx:           ctx,
+		cliInfo:       exc.cliInfo,
+		resourceAttrs: attrs,
+		newMetadata:   metadata,
+		sourceValues:  exc.sourceValues,
+		aliases:       exc.aliases,
+		limits:        exc.limits,
+		fanOutKeys:    exc.fanOutKeys,
+	}
 }
 
-func (exc *eventContext) setContextKey(key string, value []string) {
-	exc.newMetadata[key] = value
+// copyResourceTo sets the attributes of a copy of the resource, if the copy
+// actions changed them
+func (exc *eventContext) copyResourceTo(resource pcommon.Resource) {
+	if exc.resourceCopied {
+		exc.resourceAttrs.CopyTo(resource.Attributes())
+	}
 }
 
 func (exc *eventContext) getContext() context.Context {
@@ -83,32 +274,51 @@ type Action interface {
 }
 
 func generateAction(action ActionConfig) (Action, error) {
-	valueDefault := ""
+	source := valueSource{}
 	if action.ValueDefault != nil {
-		valueDefault = *action.ValueDefault
+		source.value = *action.ValueDefault
+	}
+	source.fromAttrs = action.FromAttribute
+	source.fromBody = action.FromBody
+	source.emptyAsMissing = action.EmptyAsMissing != nil && *action.EmptyAsMissing
+	if len(action.FromMetricName) > 0 {
+		source.fromMetricName = metricNameID(action.FromMetricName)
 	}
-	fromAttribute := ""
-	if action.FromAttribute != nil {
-		fromAttribute = *action.FromAttribute
+	source.removeSource = action.RemoveSource
+	source.fanOut = action.FanOut
+	source.values = action.Values
+	if action.Sanitize != "" {
+		source.sanitizer = newSanitizer(action.Sanitize, action.SanitizeMode)
+	}
+	if action.FromJWTClaim != nil {
+		claim, err := newJWTClaim(action.FromJWTClaim)
+		if err != nil {
+			return nil, err
+		}
+		source.jwtClaim = claim
+	}
+	if action.Validation != nil {
+		validator, err := newValueValidator(*action.Key, action.Validation)
+		if err != nil {
+			return nil, err
+		}
+		source.validator = validator
 	}
 	switch action.Action {
 	case INSERT:
 		return &actionInsert{
-			key:      *action.Key,
-			value:    valueDefault,
-			fromAttr: fromAttribute,
+			key:         *action.Key,
+			valueSource: source,
 		}, nil
 	case UPSERT:
 		return &actionUpsert{
-			key:      *action.Key,
-			value:    valueDefault,
-			fromAttr: fromAttribute,
+			key:         *action.Key,
+			valueSource: source,
 		}, nil
 	case UPDATE:
 		return &actionUpdate{
-			key:      *action.Key,
-			value:    valueDefault,
-			fromAttr: fromAttribute,
+			key:         *action.Key,
+			valueSource: source,
 		}, nil
 	case DELETE:
 		return &actionDelete{
@@ -119,57 +329,235 @@ func generateAction(action ActionConfig) (Action, error) {
 	}
 }
 
+// valueSource computes the value of the insert, update and upsert actions
+type valueSource struct {
+	value     string
+	fromAttrs []string
+	jwtClaim  *jwtClaim
+	fromBody  *BodyConfig
+	// fromMetricName identifies the from_metric_name source
+	fromMetricName string
+	emptyAsMissing bool
+	removeSource   bool
+	fanOut         bool
+	values         []string
+	sanitizer      *sanitizer
+	validator      *valueValidator
+}
+
+// resolve returns the value from the JWT claim, the body, the metric name or
+// the first attribute present (or the default value), the attribute it was
+// taken from if any, and true, or false when there is no value to set or the
+// data has to be dropped or rejected
+func (s *valueSource) resolve(eventContext *eventContext) (string, string, bool) {
+	if v, exists := s.claimValues(eventContext); exists && !s.missing(v[0]) {
+		value, ok := s.checkPresent(eventContext, v[0])
+		return value, "", ok
+	}
+	if v, exists := s.bodyValue(eventContext); exists && !s.missing(v) {
+		value, ok := s.checkPresent(eventContext, v)
+		return value, "", ok
+	}
+	if v, exists := s.metricNameValue(eventContext); exists && !s.missing(v) {
+		value, ok := s.checkPresent(eventContext, v)
+		return value, "", ok
+	}
+	value, source := s.value, ""
+	for _, attr := range s.fromAttrs {
+		if v, exists := eventContext.getAttrKey(attr, s.value); exists && !s.missing(v) {
+			value, source = v, attr
+			break
+		}
+	}
+	value, ok := s.checkPresent(eventContext, value)
+	return value, source, ok
+}
+
+// missing returns true if the value has to be treated as missing
+func (s *valueSource) missing(value string) bool {
+	return s.emptyAsMissing && strings.TrimSpace(value) == ""
+}
+
+// present removes the values treated as missing
+func (s *valueSource) present(values []string) []string {
+	if !s.emptyAsMissing {
+		return values
+	}
+	result := make([]string, 0, len(values))
+	for _, value := range values {
+		if !s.missing(value) {
+			result = append(result, value)
+		}
+	}
+	return result
+}
+
+// claimValues returns the values of the JWT claim, if it is defined
+func (s *valueSource) claimValues(eventContext *eventContext) ([]string, bool) {
+	if s.jwtClaim == nil {
+		return nil, false
+	}
+	return s.jwtClaim.values(eventContext)
+}
+
+// bodyValue returns the value of the body of the log records, if it is defined
+func (s *valueSource) bodyValue(eventContext *eventContext) (string, bool) {
+	if s.fromBody == nil {
+		return "", false
+	}
+	value, exists := eventContext.sourceValues.body[*s.fromBody]
+	return value, exists
+}
+
+// metricNameValue returns the value of the name of the metrics, if it is defined
+func (s *valueSource) metricNameValue(eventContext *eventContext) (string, bool) {
+	if s.fromMetricName == "" {
+		return "", false
+	}
+	value, exists := eventContext.sourceValues.metricName[s.fromMetricName]
+	return value, exists
+}
+
+// resolveAll returns all the values of the JWT claim, the body, the metric
+// name or the first attribute present (or the configured values, or the
+// default value) for the fan out actions, and the attribute they were taken
+// from if any
+func (s *valueSource) resolveAll(eventContext *eventContext) ([]string, string, bool) {
+	values, _ := s.claimValues(eventContext)
+	values = s.present(values)
+	if len(values) == 0 {
+		if v, ok := s.bodyValue(eventContext); ok && !s.missing(v) {
+			values = []string{v}
+		} else if v, ok := s.metricNameValue(eventContext); ok && !s.missing(v) {
+			values = []string{v}
+		}
+	}
+	source := ""
+	for _, attr := range s.fromAttrs {
+		if len(values) > 0 {
+			break
+		}
+		if v, exists := eventContext.getAttrValues(attr); exists {
+			values = s.present(v)
+			if len(values) > 0 {
+				source = attr
+			}
+			if !s.emptyAsMissing {
+				break
+			}
+		}
+	}
+	if len(values) == 0 {
+		values = s.present(s.values)
+	}
+	if len(values) == 0 {
+		values = []string{s.value}
+	}
+	checked := make([]string, 0, len(values))
+	seen := make(map[string]struct{}, len(values))
+	for _, value := range values {
+		value, ok := s.checkPresent(eventContext, value)
+		if eventContext.err != nil {
+			return nil, "", false
+		}
+		if _, exists := seen[value]; ok && !exists {
+			seen[value] = struct{}{}
+			checked = append(checked, value)
+		}
+	}
+	return checked, source, len(checked) > 0
+}
+
+// check sanitizes and validates the value, returns false when the data has
+// to be dropped or rejected
+func (s *valueSource) check(eventContext *eventContext, value string) (string, bool) {
+	if s.sanitizer != nil {
+		var err error
+		if value, err = s.sanitizer.sanitize(value); err != nil {
+			eventContext.err = err
+			return value, false
+		}
+	}
+	if s.validator != nil {
+		return s.validator.validate(eventContext, value)
+	}
+	return value, true
+}
+
+// checkPresent is check for a resolved value. A value treated as missing is
+// not set, unless the validation replaces it, drops or rejects the data
+func (s *valueSource) checkPresent(eventContext *eventContext, value string) (string, bool) {
+	if !s.missing(value) {
+		return s.check(eventContext, value)
+	}
+	if s.validator == nil {
+		return value, false
+	}
+	value, ok := s.validator.validate(eventContext, value)
+	return value, ok && !s.missing(value)
+}
+
+// set sets the value in the context, or all the values for fan out. It
+// returns the attribute the values were taken from, if they were set
+func (s *valueSource) set(eventContext *eventContext, key string) string {
+	if s.fanOut {
+		if values, source, ok := s.resolveAll(eventContext); ok && eventContext.setFanOutKey(key, values) {
+			return source
+		}
+	} else if value, source, ok := s.resolve(eventContext); ok && eventContext.setContextKey(key, []string{value}) {
+		return source
+	}
+	return ""
+}
+
+// removeAttr deletes the attribute used as source from the resource, only
+// when its value was set in the context
+func (s *valueSource) removeAttr(eventContext *eventContext, source string) {
+	if s.removeSource && source != "" {
+		eventContext.delAttrKey(source)
+	}
+}
+
 // Concrete actions
 
 type actionInsert struct {
-	key      string
-	value    string
-	fromAttr string
+	key string
+	valueSource
 }
 
 func (a *actionInsert) execute(eventContext *eventContext) {
-	value := []string{a.value}
-	if len(a.fromAttr) > 0 {
-		value[0], _ = eventContext.getAttrKey(a.fromAttr, a.value)
-	}
 	if currentValue, exists := eventContext.getContextKey(a.key); !exists {
-		eventContext.setContextKey(a.key, value)
+		a.removeAttr(eventContext, a.set(eventContext, a.key))
 	} else {
 		eventContext.setContextKey(a.key, currentValue)
 	}
 }
 
 type actionUpsert struct {
-	key      string
-	value    string
-	fromAttr string
+	key string
+	valueSource
 }
 
 func (a *actionUpsert) execute(eventContext *eventContext) {
-	value := []string{a.value}
-	if len(a.fromAttr) > 0 {
-		value[0], _ = eventContext.getAttrKey(a.fromAttr, a.value)
-	}
-	eventContext.setContextKey(a.key, value)
+	a.removeAttr(eventContext, a.set(eventContext, a.key))
 }
 
 type actionUpdate struct {
-	key      string
-	value    string
-	fromAttr string
+	key string
+	valueSource
 }
 
 func (a *actionUpdate) execute(eventContext *eventContext) {
-	value := []string{a.value}
-	if len(a.fromAttr) > 0 {
-		value[0], _ = eventContext.getAttrKey(a.fromAttr, a.value)
-	}
 	if v, exists := eventContext.getContextKey(a.key); exists {
-		// There are 2 views here, in this one we add the
-		// new value to the current list of strings
-		eventContext.setContextKey(a.key, append(v, value[0]))
-		// Another option is just overwriting the current value
-		// eventContext.setContextKey(a.key, value)
+		if value, source, ok := a.resolve(eventContext); ok {
+			// There are 2 views here, in this one we add the
+			// new value to the current list of strings
+			if eventContext.setContextKey(a.key, append(v, value)) {
+				a.removeAttr(eventContext, source)
+			}
+			// Another option is just overwriting the current value
+			// eventContext.setContextKey(a.key, []string{value})
+		}
 	}
 }
 
@@ -185,6 +573,20 @@ func (a *actionDelete) execute(eventContext *eventContext) {
 
 type ActionsRunner struct {
 	actions []Action
+	// copyActions are applied to each copy of the resource after the fan out
+	copyActions []Action
+	// aliases are the other names of the attributes
+	aliases *attributeAliases
+	// limits are applied to the keys set by the actions
+	limits *metadataLimiter
+	// cache has the result of the first actions
+	cache *metadataCache
+	// guards are the actions which depend on the values of the keys, they
+	// run again when a key is reassigned
+	guards []Action
+	// copyResource gives each copy its own attributes, the copy actions
+	// change them
+	copyResource bool
 }
 
 func NewActionsRunner() *ActionsRunner {
@@ -201,11 +603,143 @@ func (ar *ActionsRunner) AddAction(action ActionConfig) error {
 	return err
 }
 
-// The executeCommands method executes all the commands one by one
-func (ar *ActionsRunner) Apply(ctx context.Context, attrs pcommon.Map) context.Context {
+// Adds an action which is not defined by an ActionConfig
+func (ar *ActionsRunner) addAction(action Action) {
+	ar.actions = append(ar.actions, action)
+}
+
+// Adds an action which depends on the values of the keys set before
+func (ar *ActionsRunner) addGuardAction(action Action) {
+	ar.actions = append(ar.actions, action)
+	ar.guards = append(ar.guards, action)
+}
+
+// Adds an action applied to each copy of the resource after the fan out
+func (ar *ActionsRunner) addCopyAction(action Action) {
+	ar.copyActions = append(ar.copyActions, action)
+}
+
+// Adds an action applied to each copy of the resource after the fan out,
+// which changes the attributes of the copy
+func (ar *ActionsRunner) addResourceCopyAction(action Action) {
+	ar.copyActions = append(ar.copyActions, action)
+	ar.copyResource = true
+}
+
+// The executeCommands method executes all the commands one by one. It stops
+// if an action returns an error, errDataDropped means the data has to be
+// discarded. It returns a context for each copy of the resource to send,
+// there is more than one only with fan out actions.
+func (ar *ActionsRunner) Apply(ctx context.Context, attrs pcommon.Map) ([]context.Context, error) {
+	eventContext, err := ar.run(ctx, attrs, sourceValues{})
+	if err != nil {
+		return nil, err
+	}
+	return ar.contexts(eventContext)
+}
+
+// sourceValues are the values of the sources inside a resource, such as the
+// body of the log records. The data of the resource is split by them.
+type sourceValues struct {
+	body       map[BodyConfig]string
+	metricName map[string]string
+	// schemaURL of the resource, it decides the preferred aliases
+	schemaURL string
+}
+
+// applyWithValues is Apply with the values of the sources inside the resource,
+// it returns the EventContext of each copy of the resource
+func (ar *ActionsRunner) applyWithValues(
+	ctx context.Context,
+	attrs pcommon.Map,
+	values sourceValues) ([]*eventContext, error) {
+
+	eventContext, err := ar.run(ctx, attrs, values)
+	if err != nil {
+		return nil, err
+	}
+	return ar.copies(eventContext)
+}
+
+// run executes the actions, but not the copy actions
+func (ar *ActionsRunner) run(
+	ctx context.Context,
+	attrs pcommon.Map,
+	values sourceValues) (*eventContext, error) {
+
 	eventContext := createEventContext(ctx, attrs)
-	for _, a := range ar.actions {
+	eventContext.sourceValues = values
+	eventContext.aliases = ar.aliases
+	eventContext.limits = ar.limits
+	actions := ar.actions
+	if ar.cache != nil {
+		ar.cache.run(eventContext, actions[:ar.cache.actions])
+		if eventContext.err != nil {
+			return nil, eventContext.err
+		}
+		actions = actions[ar.cache.actions:]
+	}
+	for _, a := range actions {
 		a.execute(eventContext)
+		if eventContext.err != nil {
+			return nil, eventContext.err
+		}
+	}
+	return eventContext, nil
+}
+
+// reassign returns a copy of the EventContext with a single value in the key,
+// the guards are executed again with it
+func (ar *ActionsRunner) reassign(
+	ctx context.Context,
+	exc *eventContext,
+	attrs pcommon.Map,
+	key, value string) *eventContext {
+
+	reassigned := exc.withKey(ctx, attrs, key, value)
+	for _, a := range ar.guards {
+		a.execute(reassigned)
+	}
+	return reassigned
+}
+
+// contexts returns the context of each copy of the resource
+func (ar *ActionsRunner) contexts(eventContext *eventContext) ([]context.Context, error) {
+	copies, err := ar.copies(eventContext)
+	if err != nil {
+		return nil, err
+	}
+	ctxs := make([]context.Context, 0, len(copies))
+	for _, copyContext := range copies {
+		ctxs = append(ctxs, copyContext.getContext())
+	}
+	return ctxs, nil
+}
+
+// copies splits the metadata of the fan out keys and executes the copy
+// actions on each copy of the resource
+func (ar *ActionsRunner) copies(exc *eventContext) ([]*eventContext, error) {
+	metadata := exc.splitMetadata()
+	copies := make([]*eventContext, 0, len(metadata))
+	for _, md := range metadata {
+		copyContext := exc.copyWith(md)
+		// Without split the copy has the same metadata, the copy actions must
+		// not change the one of the resource
+		copyContext.metadataShared = len(metadata) == 1
+		if ar.copyResource {
+			// The copy actions change the attributes of their own copy
+			attrs := pcommon.NewMap()
+			exc.resourceAttrs.CopyTo(attrs)
+			copyContext.resourceAttrs = attrs
+			copyContext.resourceCopied = true
+		}
+		for _, a := range ar.copyActions {
+			a.execute(copyContext)
+			if copyContext.err != nil {
+				return nil, copyContext.err
+			}
+		}
+		copies = append(copies, copyContext)
 	}
-	return eventContext.getContext()
+	return copies, nil
 }
@@ -0,0 +1,352 @@
+package contextprocessor
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/collector/client"
+	"go.opentelemetry.io/collector/consumer"
+	"go.opentelemetry.io/collector/pdata/pcommon"
+	"go.opentelemetry.io/collector/pdata/plog"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/metric/noop"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+func newTestMeter() metric.Meter {
+	return noop.NewMeterProvider().Meter(scopeName)
+}
+
+// newTestMetricReader returns a meter whose metrics are collected by the reader
+func newTestMetricReader() (metric.Meter, *sdkmetric.ManualReader) {
+	reader := sdkmetric.NewManualReader()
+	provider := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))
+	return provider.Meter(scopeName), reader
+}
+
+// collectSum returns the data points of the int64 counter, nil if it has none
+func collectSum(t *testing.T, reader *sdkmetric.ManualReader, name string) []metricdata.DataPoint[int64] {
+	var rm metricdata.ResourceMetrics
+	require.NoError(t, reader.Collect(context.Background(), &rm))
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			if m.Name == name {
+				return m.Data.(metricdata.Sum[int64]).DataPoints
+			}
+		}
+	}
+	return nil
+}
+
+func newTestProcessorID() attribute.KeyValue {
+	return attribute.String("processor", "context")
+}
+
+// testLogsSink records the logs and the contexts of the calls
+type testLogsSink struct {
+	mutex    sync.Mutex
+	contexts []context.Context
+	logs     []plog.Logs
+}
+
+func (s *testLogsSink) Capabilities() consumer.Capabilities {
+	return consumer.Capabilities{}
+}
+
+func (s *testLogsSink) ConsumeLogs(ctx context.Context, ld plog.Logs) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.contexts = append(s.contexts, ctx)
+	s.logs = append(s.logs, ld)
+	return nil
+}
+
+func newTestAttributes(attrs map[string]any) pcommon.Map {
+	m := pcommon.NewMap()
+	_ = m.FromRaw(attrs)
+	return m
+}
+
+func TestApplyFromAttributeFallback(t *testing.T) {
+	key := "x-scope-orgid"
+	value := "anonymous"
+	ar := NewActionsRunner()
+	require.NoError(t, ar.AddAction(ActionConfig{
+		Key:           &key,
+		Action:        UPSERT,
+		ValueDefault:  &value,
+		FromAttribute: AttributeNames{"tenant", "service.namespace", "k8s.namespace.name"},
+	}))
+
+	// Resources in the middle of a migration between attributes
+	tests := []struct {
+		name     string
+		attrs    map[string]any
+		expected string
+	}{
+		{
+			name:     "first attribute",
+			attrs:    map[string]any{"tenant": "a", "service.namespace": "b", "k8s.namespace.name": "c"},
+			expected: "a",
+		},
+		{
+			name:     "second attribute",
+			attrs:    map[string]any{"service.namespace": "b", "k8s.namespace.name": "c"},
+			expected: "b",
+		},
+		{
+			name:     "last attribute",
+			attrs:    map[string]any{"k8s.namespace.name": "c", "service.name": "d"},
+			expected: "c",
+		},
+		{
+			name:     "no attribute",
+			attrs:    map[string]any{"service.name": "d"},
+			expected: "anonymous",
+		},
+		{
+			name:     "non string attribute",
+			attrs:    map[string]any{"service.namespace": 42, "k8s.namespace.name": "c"},
+			expected: "42",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctxs, err := ar.Apply(context.Background(), newTestAttributes(tt.attrs))
+			require.NoError(t, err)
+			require.Len(t, ctxs, 1)
+			assert.Equal(t, []string{tt.expected}, client.FromContext(ctxs[0]).Metadata.Get(key))
+		})
+	}
+}
+
+func TestApplyRemoveSource(t *testing.T) {
+	key := "x-scope-orgid"
+	value := "anonymous"
+	tests := []struct {
+		name     string
+		action   ActionType
+		metadata map[string][]string
+		attrs    map[string]any
+		expected []string
+		removed  bool
+	}{
+		{
+			name:     "upsert from attribute",
+			action:   UPSERT,
+			attrs:    map[string]any{"tenant": "a"},
+			expected: []string{"a"},
+			removed:  true,
+		},
+		{
+			name:     "upsert from default",
+			action:   UPSERT,
+			attrs:    map[string]any{"service.name": "b"},
+			expected: []string{"anonymous"},
+		},
+		{
+			name:     "insert with existing key",
+			action:   INSERT,
+			metadata: map[string][]string{key: {"receiver"}},
+			attrs:    map[string]any{"tenant": "a"},
+			expected: []string{"receiver"},
+		},
+		{
+			name:     "insert without key",
+			action:   INSERT,
+			attrs:    map[string]any{"tenant": "a"},
+			expected: []string{"a"},
+			removed:  true,
+		},
+		{
+			name:   "update without key",
+			action: UPDATE,
+			attrs:  map[string]any{"tenant": "a"},
+		},
+		{
+			name:     "update with existing key",
+			action:   UPDATE,
+			metadata: map[string][]string{key: {"receiver"}},
+			attrs:    map[string]any{"tenant": "a"},
+			expected: []string{"receiver", "a"},
+			removed:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ar := NewActionsRunner()
+			require.NoError(t, ar.AddAction(ActionConfig{
+				Key:           &key,
+				Action:        tt.action,
+				ValueDefault:  &value,
+				FromAttribute: AttributeNames{"tenant"},
+				RemoveSource:  true,
+			}))
+			ctx := client.NewContext(context.Background(), client.Info{Metadata: client.NewMetadata(tt.metadata)})
+			attrs := newTestAttributes(tt.attrs)
+			ctxs, err := ar.Apply(ctx, attrs)
+			require.NoError(t, err)
+			require.Len(t, ctxs, 1)
+			assert.Equal(t, tt.expected, client.FromContext(ctxs[0]).Metadata.Get(key))
+			if _, ok := tt.attrs["tenant"]; ok {
+				_, exists := attrs.Get("tenant")
+				assert.Equal(t, tt.removed, !exists)
+			}
+		})
+	}
+}
+
+func TestApplyKeyCase(t *testing.T) {
+	value := "from-processor"
+	tests := []struct {
+		name     string
+		key      string
+		action   ActionType
+		expected []string
+	}{
+		// The receiver already set the key with another case, insert keeps its value
+		{name: "insert", key: "Tenant", action: INSERT, expected: []string{"from-receiver"}},
+		{name: "update", key: "TENANT", action: UPDATE, expected: []string{"from-receiver", "from-processor"}},
+		{name: "upsert", key: "Tenant", action: UPSERT, expected: []string{"from-processor"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key := tt.key
+			ar := NewActionsRunner()
+			require.NoError(t, ar.AddAction(ActionConfig{Key: &key, Action: tt.action, ValueDefault: &value}))
+			ctx := client.NewContext(context.Background(), client.Info{
+				Metadata: client.NewMetadata(map[string][]string{"tenant": {"from-receiver"}}),
+			})
+			exc, err := ar.run(ctx, pcommon.NewMap(), sourceValues{})
+			require.NoError(t, err)
+			// A single key is set, in lowercase
+			assert.Equal(t, map[string][]string{"tenant": tt.expected}, exc.newMetadata)
+			ctxs, err := ar.contexts(exc)
+			require.NoError(t, err)
+			require.Len(t, ctxs, 1)
+			assert.Equal(t, tt.expected, client.FromContext(ctxs[0]).Metadata.Get("Tenant"))
+		})
+	}
+}
+
+func TestApplyEmptyAsMissing(t *testing.T) {
+	key := "x-scope-orgid"
+	anonymous := "anonymous"
+	disabled := false
+	receiver := map[string][]string{key: {"receiver"}}
+	tests := []struct {
+		name           string
+		action         ActionType
+		global         bool
+		emptyAsMissing *bool
+		metadata       map[string][]string
+		expected       func(empty string) []string
+	}{
+		{
+			name:     "insert",
+			action:   INSERT,
+			global:   true,
+			expected: func(string) []string { return []string{anonymous} },
+		},
+		{
+			name:     "update",
+			action:   UPDATE,
+			global:   true,
+			metadata: receiver,
+			expected: func(string) []string { return []string{"receiver", anonymous} },
+		},
+		{
+			name:     "upsert",
+			action:   UPSERT,
+			global:   true,
+			expected: func(string) []string { return []string{anonymous} },
+		},
+		{
+			// The empty values are kept by default
+			name:     "upsert without empty_as_missing",
+			action:   UPSERT,
+			expected: func(empty string) []string { return []string{empty} },
+		},
+		{
+			name:           "insert overriding the global setting",
+			action:         INSERT,
+			global:         true,
+			emptyAsMissing: &disabled,
+			expected:       func(empty string) []string { return []string{empty} },
+		},
+		{
+			name:           "update overriding the global setting",
+			action:         UPDATE,
+			global:         true,
+			emptyAsMissing: &disabled,
+			metadata:       receiver,
+			expected:       func(empty string) []string { return []string{"receiver", empty} },
+		},
+	}
+	// A null attribute is read as an empty string
+	empties := map[string]any{"empty": "", "whitespace": " \t", "null": nil}
+	for _, tt := range tests {
+		for emptyName, empty := range empties {
+			t.Run(tt.name+" "+emptyName, func(t *testing.T) {
+				cfg := &Config{
+					EmptyAsMissing: tt.global,
+					ActionsConfig: []ActionConfig{{
+						Key:            &key,
+						Action:         tt.action,
+						ValueDefault:   &anonymous,
+						FromAttribute:  AttributeNames{"tenant"},
+						EmptyAsMissing: tt.emptyAsMissing,
+					}},
+				}
+				ar := NewActionsRunner()
+				for _, action := range cfg.actions() {
+					require.NoError(t, ar.AddAction(action))
+				}
+				ctx := client.NewContext(context.Background(), client.Info{Metadata: client.NewMetadata(tt.metadata)})
+				ctxs, err := ar.Apply(ctx, newTestAttributes(map[string]any{"tenant": empty}))
+				require.NoError(t, err)
+				require.Len(t, ctxs, 1)
+				value, _ := empty.(string)
+				assert.Equal(t, tt.expected(value), client.FromContext(ctxs[0]).Metadata.Get(key))
+			})
+		}
+	}
+}
+
+func TestApplyEmptyAsMissingSources(t *testing.T) {
+	key := "x-scope-orgid"
+	enabled := true
+	ar := NewActionsRunner()
+	// Without value, the key is not set unless the validation drops the data
+	require.NoError(t, ar.AddAction(ActionConfig{
+		Key:            &key,
+		Action:         UPSERT,
+		FromAttribute:  AttributeNames{"tenant", "service.namespace"},
+		EmptyAsMissing: &enabled,
+	}))
+	ctxs, err := ar.Apply(context.Background(), newTestAttributes(map[string]any{"tenant": " ", "service.namespace": "team-a"}))
+	require.NoError(t, err)
+	require.Len(t, ctxs, 1)
+	assert.Equal(t, []string{"team-a"}, client.FromContext(ctxs[0]).Metadata.Get(key))
+
+	ctxs, err = ar.Apply(context.Background(), newTestAttributes(map[string]any{"tenant": "", "service.namespace": nil}))
+	require.NoError(t, err)
+	require.Len(t, ctxs, 1)
+	assert.Empty(t, client.FromContext(ctxs[0]).Metadata.Get(key))
+
+	strict := NewActionsRunner()
+	require.NoError(t, strict.AddAction(ActionConfig{
+		Key:            &key,
+		Action:         UPSERT,
+		FromAttribute:  AttributeNames{"tenant"},
+		EmptyAsMissing: &enabled,
+		Validation:     &ValidationConfig{Regex: ".+", OnInvalid: INVALID_DROP},
+	}))
+	_, err = strict.Apply(context.Background(), newTestAttributes(map[string]any{"tenant": "  "}))
+	assert.ErrorIs(t, err, errDataDropped)
+}
@@ -0,0 +1,117 @@
+package contextprocessor
+
+import (
+	"strconv"
+	"strings"
+)
+
+// semconvRename is an attribute renamed in a version of the semantic conventions
+type semconvRename struct {
+	from    string
+	to      string
+	version schemaVersion
+}
+
+// Resource attributes renamed by the semantic conventions. Only the renames
+// with the same type and meaning are included, the others need
+// attribute_aliases.
+var semconvRenames = []semconvRename{
+	{from: "deployment.environment", to: "deployment.environment.name", version: schemaVersion{1, 27, 0}},
+	{from: "telemetry.auto.version", to: "telemetry.distro.version", version: schemaVersion{1, 25, 0}},
+	{from: "browser.user_agent", to: "user_agent.original", version: schemaVersion{1, 19, 0}},
+}
+
+// schemaVersion is the major, minor and patch version of a schema URL
+type schemaVersion [3]int
+
+// parseSchemaURL returns the version of the schema URL, the last element of
+// the path, eg. https://opentelemetry.io/schemas/1.26.0
+func parseSchemaURL(url string) (schemaVersion, bool) {
+	version := schemaVersion{}
+	parts := strings.Split(url[strings.LastIndex(url, "/")+1:], ".")
+	if len(parts) != 3 {
+		return version, false
+	}
+	for i, part := range parts {
+		n, err := strconv.Atoi(part)
+		if err != nil {
+			return version, false
+		}
+		version[i] = n
+	}
+	return version, true
+}
+
+func (v schemaVersion) atLeast(other schemaVersion) bool {
+	for i := range v {
+		if v[i] != other[i] {
+			return v[i] > other[i]
+		}
+	}
+	return true
+}
+
+// aliasGroup are the names of an attribute
+type aliasGroup struct {
+	// names in order of preference
+	names []string
+	// rename is defined for the groups of the semantic conventions
+	rename *semconvRename
+}
+
+// attributeAliases finds the group of names of the attributes
+type attributeAliases struct {
+	groups map[string]*aliasGroup
+}
+
+func newAttributeAliases(semconv bool, aliases map[string][]string) *attributeAliases {
+	if !semconv && len(aliases) == 0 {
+		return nil
+	}
+	a := &attributeAliases{
+		groups: make(map[string]*aliasGroup),
+	}
+	if semconv {
+		for i := range semconvRenames {
+			rename := &semconvRenames[i]
+			group := &aliasGroup{
+				names:  []string{rename.to, rename.from},
+				rename: rename,
+			}
+			a.groups[rename.from] = group
+			a.groups[rename.to] = group
+		}
+	}
+	// The user defined aliases replace the ones of the semantic conventions
+	for name, names := range aliases {
+		group := &aliasGroup{
+			names: append([]string{name}, names...),
+		}
+		for _, n := range group.names {
+			a.groups[n] = group
+		}
+	}
+	return a
+}
+
+// names returns the names of the attribute in order of preference. The
+// version of the schema URL decides between the names of the semantic
+// conventions, without it the name requested is preferred.
+func (a *attributeAliases) names(name, schemaURL string) []string {
+	group, exists := a.groups[name]
+	if !exists {
+		return []string{name}
+	}
+	if group.rename == nil {
+		return group.names
+	}
+	version, ok := parseSchemaURL(schemaURL)
+	switch {
+	case !ok && name == group.rename.from:
+		return []string{group.rename.from, group.rename.to}
+	case ok && !version.atLeast(group.rename.version):
+		return []string{group.rename.from, group.rename.to}
+	default:
+		return group.names
+	}
+}
@@ -0,0 +1,72 @@
+package contextprocessor
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseSchemaURL(t *testing.T) {
+	tests := []struct {
+		url      string
+		expected schemaVersion
+		ok       bool
+	}{
+		{url: "https://opentelemetry.io/schemas/1.26.0", expected: schemaVersion{1, 26, 0}, ok: true},
+		{url: "https://example.com/schemas/v2/10.2.3", expected: schemaVersion{10, 2, 3}, ok: true},
+		{url: "1.4.0", expected: schemaVersion{1, 4, 0}, ok: true},
+		{url: ""},
+		{url: "https://opentelemetry.io/schemas/1.26"},
+		{url: "https://opentelemetry.io/schemas/1.26.0.1"},
+		{url: "https://opentelemetry.io/schemas/1.x.0"},
+		{url: "https://opentelemetry.io/schemas/1.26.0/"},
+	}
+	for _, tt := range tests {
+		version, ok := parseSchemaURL(tt.url)
+		assert.Equal(t, tt.ok, ok, tt.url)
+		if tt.ok {
+			assert.Equal(t, tt.expected, version, tt.url)
+		}
+	}
+	assert.True(t, schemaVersion{1, 27, 0}.atLeast(schemaVersion{1, 27, 0}))
+	assert.True(t, schemaVersion{2, 0, 0}.atLeast(schemaVersion{1, 27, 0}))
+	assert.False(t, schemaVersion{1, 26, 9}.atLeast(schemaVersion{1, 27, 0}))
+}
+
+func TestAttributeAliasesNames(t *testing.T) {
+	assert.Nil(t, newAttributeAliases(false, nil))
+
+	aliases := newAttributeAliases(true, map[string][]string{
+		"team":                   {"owner", "squad"},
+		"telemetry.auto.version": {"agent.version"},
+	})
+	old := "https://opentelemetry.io/schemas/1.26.0"
+	current := "https://opentelemetry.io/schemas/1.27.0"
+	tests := []struct {
+		name      string
+		schemaURL string
+		expected  []string
+	}{
+		{name: "service.name", schemaURL: current, expected: []string{"service.name"}},
+		// The schema URL decides the preferred name
+		{name: "deployment.environment", schemaURL: current, expected: []string{"deployment.environment.name", "deployment.environment"}},
+		{name: "deployment.environment.name", schemaURL: old, expected: []string{"deployment.environment", "deployment.environment.name"}},
+		{name: "deployment.environment", schemaURL: old, expected: []string{"deployment.environment", "deployment.environment.name"}},
+		// Without schema URL the requested name is preferred
+		{name: "deployment.environment", expected: []string{"deployment.environment", "deployment.environment.name"}},
+		{name: "deployment.environment.name", expected: []string{"deployment.environment.name", "deployment.environment"}},
+		{name: "browser.user_agent", schemaURL: "https://opentelemetry.io/schemas/1.19.0", expected: []string{"user_agent.original", "browser.user_agent"}},
+		// The user defined aliases do not depend on the schema URL
+		{name: "owner", schemaURL: old, expected: []string{"team", "owner", "squad"}},
+		{name: "squad", expected: []string{"team", "owner", "squad"}},
+		// and they replace the ones of the semantic conventions
+		{name: "telemetry.auto.version", schemaURL: current, expected: []string{"telemetry.auto.version", "agent.version"}},
+		{name: "telemetry.distro.version", schemaURL: current, expected: []string{"telemetry.distro.version", "telemetry.auto.version"}},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.expected, aliases.names(tt.name, tt.schemaURL), "%s %s", tt.name, tt.schemaURL)
+	}
+
+	aliases = newAttributeAliases(false, map[string][]string{"team": {"owner"}})
+	assert.Equal(t, []string{"deployment.environment"}, aliases.names("deployment.environment", current))
+}
@@ -0,0 +1,206 @@
+package contextprocessor
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"go.opentelemetry.io/collector/pdata/pcommon"
+	"go.opentelemetry.io/collector/pdata/plog"
+)
+
+// bodyExtractor gets the value of a from_body source from a log record
+type bodyExtractor struct {
+	cfg   BodyConfig
+	path  []string
+	regex *regexp.Regexp
+}
+
+// bodyExtractors returns an extractor for each different from_body source
+// of the actions and the rules
+func (cfg *Config) bodyExtractors() ([]*bodyExtractor, error) {
+	actions := cfg.actions()
+	for _, rule := range cfg.Rules {
+		actions = append(actions, rule.ActionsConfig...)
+	}
+	extractors := make([]*bodyExtractor, 0)
+	seen := make(map[BodyConfig]struct{})
+	for _, action := range actions {
+		if action.FromBody == nil {
+			continue
+		}
+		if _, exists := seen[*action.FromBody]; exists {
+			continue
+		}
+		seen[*action.FromBody] = struct{}{}
+		e, err := newBodyExtractor(*action.FromBody)
+		if err != nil {
+			return nil, err
+		}
+		extractors = append(extractors, e)
+	}
+	return extractors, nil
+}
+
+func newBodyExtractor(cfg BodyConfig) (*bodyExtractor, error) {
+	e := &bodyExtractor{cfg: cfg}
+	if cfg.JSONPath != "" {
+		e.path = strings.Split(strings.TrimPrefix(cfg.JSONPath, "$."), ".")
+	}
+	if cfg.Regex != "" {
+		regex, err := regexp.Compile(cfg.Regex)
+		if err != nil {
+			return nil, err
+		}
+		e.regex = regex
+	}
+	return e, nil
+}
+
+// extract returns the value of the body
+func (e *bodyExtractor) extract(body pcommon.Value) (string, bool) {
+	switch body.Type() {
+	case pcommon.ValueTypeMap:
+		if e.path != nil {
+			return lookupValue(body, e.path)
+		}
+	case pcommon.ValueTypeStr:
+		str := body.Str()
+		if e.path != nil && strings.HasPrefix(strings.TrimSpace(str), "{") {
+			var parsed any
+			if err := json.Unmarshal([]byte(str), &parsed); err == nil {
+				if value, exists := lookupJSON(parsed, e.path); exists {
+					return value, true
+				}
+			}
+		}
+		if e.regex != nil {
+			match := e.regex.FindStringSubmatch(str)
+			switch {
+			case match == nil:
+			case len(match) > 1:
+				return match[1], true
+			default:
+				return match[0], true
+			}
+		}
+	}
+	return "", false
+}
+
+// lookupValue follows the path in a map body
+func lookupValue(value pcommon.Value, path []string) (string, bool) {
+	for _, key := range path {
+		switch value.Type() {
+		case pcommon.ValueTypeMap:
+			v, exists := value.Map().Get(key)
+			if !exists {
+				return "", false
+			}
+			value = v
+		case pcommon.ValueTypeSlice:
+			i, err := strconv.Atoi(key)
+			if err != nil || i < 0 || i >= value.Slice().Len() {
+				return "", false
+			}
+			value = value.Slice().At(i)
+		default:
+			return "", false
+		}
+	}
+	switch value.Type() {
+	case pcommon.ValueTypeMap, pcommon.ValueTypeSlice, pcommon.ValueTypeEmpty:
+		return "", false
+	default:
+		return value.AsString(), true
+	}
+}
+
+// lookupJSON follows the path in a parsed JSON string body
+func lookupJSON(value any, path []string) (string, bool) {
+	for _, key := range path {
+		switch v := value.(type) {
+		case map[string]any:
+			next, exists := v[key]
+			if !exists {
+				return "", false
+			}
+			value = next
+		case []any:
+			i, err := strconv.Atoi(key)
+			if err != nil || i < 0 || i >= len(v) {
+				return "", false
+			}
+			value = v[i]
+		default:
+			return "", false
+		}
+	}
+	switch v := value.(type) {
+	case string:
+		return v, true
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), true
+	case bool:
+		return strconv.FormatBool(v), true
+	default:
+		return "", false
+	}
+}
+
+// bodyGroup is a copy of a resource with the log records with the same values
+type bodyGroup struct {
+	values map[BodyConfig]string
+	logs   plog.Logs
+	scopes map[int]plog.ScopeLogs
+}
+
+// splitByBody returns a copy of the resource for each combination of values
+// of the extractors in the log records, in order of appearance
+func splitByBody(rl plog.ResourceLogs, extractors []*bodyExtractor) []*bodyGroup {
+	groups := make([]*bodyGroup, 0, 1)
+	index := make(map[string]*bodyGroup)
+	var key strings.Builder
+	sls := rl.ScopeLogs()
+	for i := 0; i < sls.Len(); i++ {
+		sl := sls.At(i)
+		records := sl.LogRecords()
+		for j := 0; j < records.Len(); j++ {
+			record := records.At(j)
+			values := make(map[BodyConfig]string, len(extractors))
+			key.Reset()
+			for _, e := range extractors {
+				if value, exists := e.extract(record.Body()); exists {
+					values[e.cfg] = value
+					fmt.Fprintf(&key, "1%d:%s", len(value), value)
+				} else {
+					key.WriteString("0")
+				}
+			}
+			group, exists := index[key.String()]
+			if !exists {
+				group = &bodyGroup{
+					values: values,
+					logs:   plog.NewLogs(),
+					scopes: make(map[int]plog.ScopeLogs),
+				}
+				newRl := group.logs.ResourceLogs().AppendEmpty()
+				rl.Resource().CopyTo(newRl.Resource())
+				newRl.SetSchemaUrl(rl.SchemaUrl())
+				index[key.String()] = group
+				groups = append(groups, group)
+			}
+			scope, exists := group.scopes[i]
+			if !exists {
+				scope = group.logs.ResourceLogs().At(0).ScopeLogs().AppendEmpty()
+				sl.Scope().CopyTo(scope.Scope())
+				scope.SetSchemaUrl(sl.SchemaUrl())
+				group.scopes[i] = scope
+			}
+			record.CopyTo(scope.LogRecords().AppendEmpty())
+		}
+	}
+	return groups
+}
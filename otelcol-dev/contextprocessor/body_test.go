@@ -0,0 +1,120 @@
+package contextprocessor
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/collector/client"
+	"go.opentelemetry.io/collector/pdata/pcommon"
+	"go.opentelemetry.io/collector/pdata/plog"
+	"go.opentelemetry.io/collector/processor/processortest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func newTestBody(t *testing.T, body any) pcommon.Value {
+	value := pcommon.NewValueEmpty()
+	require.NoError(t, value.FromRaw(body))
+	return value
+}
+
+func TestBodyExtract(t *testing.T) {
+	e, err := newBodyExtractor(BodyConfig{JSONPath: "$.meta.tenants.1", Regex: `tenant=(\w+)`})
+	require.NoError(t, err)
+	tests := []struct {
+		name     string
+		body     any
+		expected string
+		ok       bool
+	}{
+		{name: "map", body: map[string]any{"meta": map[string]any{"tenants": []any{"a", "b"}}}, expected: "b", ok: true},
+		{name: "map number", body: map[string]any{"meta": map[string]any{"tenants": []any{1, 2}}}, expected: "2", ok: true},
+		{name: "map missing", body: map[string]any{"meta": map[string]any{"tenants": []any{"a"}}}},
+		{name: "map object", body: map[string]any{"meta": map[string]any{"tenants": []any{"a", map[string]any{}}}}},
+		{name: "json string", body: `{"meta": {"tenants": ["a", "b"]}}`, expected: "b", ok: true},
+		{name: "json string bool", body: ` {"meta": {"tenants": [true, false]}}`, expected: "false", ok: true},
+		// The regex is used when the path does not give a value
+		{name: "json string fallback", body: `{"meta": {}, "msg": "tenant=c"}`, expected: "c", ok: true},
+		{name: "invalid json", body: `{"meta": tenant=d`, expected: "d", ok: true},
+		{name: "string", body: "GET /api tenant=e 200", expected: "e", ok: true},
+		{name: "no match", body: "GET /api 200"},
+		{name: "int", body: 42},
+	}
+	for _, tt := range tests {
+		value, ok := e.extract(newTestBody(t, tt.body))
+		assert.Equal(t, tt.ok, ok, tt.name)
+		assert.Equal(t, tt.expected, value, tt.name)
+	}
+
+	// Without groups the whole match is the value
+	e, err = newBodyExtractor(BodyConfig{Regex: `team-\w+`})
+	require.NoError(t, err)
+	value, ok := e.extract(newTestBody(t, "owner team-a"))
+	assert.True(t, ok)
+	assert.Equal(t, "team-a", value)
+	// The path is not used with the regex alone
+	_, ok = e.extract(newTestBody(t, map[string]any{"owner": "team-a"}))
+	assert.False(t, ok)
+
+	_, err = newBodyExtractor(BodyConfig{Regex: "("})
+	assert.Error(t, err)
+}
+
+func TestLogsFromBody(t *testing.T) {
+	key := "x-scope-orgid"
+	value := "anonymous"
+	cfg := &Config{
+		ActionsConfig: []ActionConfig{{
+			Key:           &key,
+			Action:        UPSERT,
+			FromBody:      &BodyConfig{JSONPath: "tenant", Regex: `tenant=([\w-]+)`},
+			FromAttribute: AttributeNames{"tenant"},
+			ValueDefault:  &value,
+		}},
+	}
+	require.NoError(t, cfg.Validate())
+	sink := &testLogsSink{}
+	p, err := NewContextLogsProcessor(processortest.NewNopSettings(), sink, trace.WithAttributes(), cfg)
+	require.NoError(t, err)
+
+	ld := plog.NewLogs()
+	rl := ld.ResourceLogs().AppendEmpty()
+	rl.Resource().Attributes().PutStr("tenant", "team-z")
+	for i, body := range []any{
+		map[string]any{"tenant": "team-a"},
+		"tenant=team-b",
+		`{"tenant": "team-a"}`,
+		"no tenant",
+	} {
+		sl := rl.ScopeLogs().AppendEmpty()
+		sl.Scope().SetName(string(rune('a' + i)))
+		require.NoError(t, sl.LogRecords().AppendEmpty().Body().FromRaw(body))
+	}
+	// A resource without log records is forwarded as it is
+	empty := ld.ResourceLogs().AppendEmpty()
+	empty.ScopeLogs().AppendEmpty().Scope().SetName("empty")
+	require.NoError(t, p.ConsumeLogs(context.Background(), ld))
+
+	expected := []struct {
+		tenant string
+		scopes []string
+	}{
+		{tenant: "team-a", scopes: []string{"a", "c"}},
+		{tenant: "team-b", scopes: []string{"b"}},
+		// The log records without value use the next sources
+		{tenant: "team-z", scopes: []string{"d"}},
+		{tenant: "anonymous", scopes: []string{"empty"}},
+	}
+	require.Len(t, sink.logs, len(expected))
+	for i, sent := range sink.logs {
+		assert.Equal(t, []string{expected[i].tenant}, client.FromContext(sink.contexts[i]).Metadata.Get(key), i)
+		sls := sent.ResourceLogs().At(0).ScopeLogs()
+		scopes := []string{}
+		for j := 0; j < sls.Len(); j++ {
+			scopes = append(scopes, sls.At(j).Scope().Name())
+		}
+		assert.Equal(t, expected[i].scopes, scopes, i)
+	}
+	assert.Equal(t, 4, sink.logs[0].LogRecordCount()+sink.logs[1].LogRecordCount()+sink.logs[2].LogRecordCount())
+}
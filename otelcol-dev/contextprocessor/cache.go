@@ -0,0 +1,279 @@
+package contextprocessor
+
+import (
+	"container/list"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/collector/pdata/pcommon"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+const (
+	defaultCacheEntries = 10000
+	defaultCacheTTL     = time.Minute
+)
+
+// cacheEntry is the state of the context once the cached actions are applied
+type cacheEntry struct {
+	key        string
+	metadata   map[string][]string
+	fanOutKeys []string
+	err        error
+	// expires is the end of the TTL, or the expiry of the tokens read
+	expires time.Time
+	elem    *list.Element
+}
+
+// metadataCache remembers the metadata set by the first actions (the actions
+// and the rules) in a LRU cache, for each combination of the values they
+// read: the resource attributes, the incoming metadata and the values of the
+// sources inside the resource. The values themselves are the key, so
+// different resources never share an entry.
+type metadataCache struct {
+	// actions is the number of actions cached
+	actions    int
+	attrNames  []string
+	keys       []string
+	maxEntries int
+	ttl        time.Duration
+	mutex      sync.Mutex
+	entries    map[string]*cacheEntry
+	// lru has the entries, the most recently used first
+	lru    *list.List
+	attrs  metric.MeasurementOption
+	hits   metric.Int64Counter
+	misses metric.Int64Counter
+}
+
+func newMetadataCache(
+	meter metric.Meter,
+	processor attribute.KeyValue,
+	cfg *Config,
+	actions int) (*metadataCache, error) {
+
+	hits, err := meter.Int64Counter(
+		"processor_context_cache_hits",
+		metric.WithDescription("Number of resources with the metadata taken from the cache"),
+		metric.WithUnit("{resources}"),
+	)
+	if err != nil {
+		return nil, err
+	}
+	misses, err := meter.Int64Counter(
+		"processor_context_cache_misses",
+		metric.WithDescription("Number of resources with the metadata resolved by the actions"),
+		metric.WithUnit("{resources}"),
+	)
+	if err != nil {
+		return nil, err
+	}
+	attrNames, keys := cfg.cacheKeys()
+	c := &metadataCache{
+		actions:    actions,
+		attrNames:  attrNames,
+		keys:       keys,
+		maxEntries: cfg.Cache.MaxEntries,
+		ttl:        cfg.Cache.TTL,
+		entries:    make(map[string]*cacheEntry),
+		lru:        list.New(),
+		attrs:      metric.WithAttributes(processor),
+		hits:       hits,
+		misses:     misses,
+	}
+	if c.maxEntries == 0 {
+		c.maxEntries = defaultCacheEntries
+	}
+	if c.ttl == 0 {
+		c.ttl = defaultCacheTTL
+	}
+	return c, nil
+}
+
+// cacheKeys returns the resource attributes, with their aliases, and the
+// metadata keys read by the actions and the rules
+func (cfg *Config) cacheKeys() ([]string, []string) {
+	attrs := make(map[string]struct{})
+	keys := make(map[string]struct{})
+	actions := cfg.actions()
+	for _, rule := range cfg.rules() {
+		actions = append(actions, rule.ActionsConfig...)
+		for name := range rule.Match.Attributes {
+			attrs[name] = struct{}{}
+		}
+		for _, name := range rule.Match.Exists {
+			attrs[name] = struct{}{}
+		}
+		for key := range rule.Match.Metadata {
+			keys[canonicalKey(key)] = struct{}{}
+		}
+	}
+	for _, action := range actions {
+		for _, name := range action.FromAttribute {
+			attrs[name] = struct{}{}
+		}
+		if action.Key != nil {
+			keys[canonicalKey(*action.Key)] = struct{}{}
+		}
+		if action.FromJWTClaim != nil {
+			key := action.FromJWTClaim.MetadataKey
+			if key == "" {
+				key = defaultJWTKey
+			}
+			keys[canonicalKey(key)] = struct{}{}
+		}
+	}
+	if aliases := newAttributeAliases(cfg.SemconvAliases, cfg.AttributeAliases); aliases != nil {
+		for name := range attrs {
+			for _, n := range aliases.names(name, "") {
+				attrs[n] = struct{}{}
+			}
+		}
+	}
+	return sortedKeys(attrs), sortedKeys(keys)
+}
+
+func sortedKeys(m map[string]struct{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// key appends the values read by the cached actions to the buffer, each one
+// prefixed by its length
+func (c *metadataCache) key(buf []byte, eventContext *eventContext) []byte {
+	appendPart := func(buf []byte, s string) []byte {
+		buf = strconv.AppendInt(buf, int64(len(s)), 10)
+		buf = append(buf, ':')
+		return append(buf, s...)
+	}
+	buf = appendPart(buf, eventContext.sourceValues.schemaURL)
+	for _, name := range c.attrNames {
+		if v, exists := eventContext.resourceAttrs.Get(name); exists {
+			buf = append(buf, byte('0'+v.Type()))
+			if v.Type() == pcommon.ValueTypeStr {
+				buf = appendPart(buf, v.Str())
+			} else {
+				buf = appendPart(buf, v.AsString())
+			}
+		} else {
+			buf = append(buf, '-')
+		}
+	}
+	for _, k := range c.keys {
+		values := eventContext.cliInfo.Metadata.Get(k)
+		buf = strconv.AppendInt(buf, int64(len(values)), 10)
+		for _, value := range values {
+			buf = appendPart(buf, value)
+		}
+	}
+	// The sources inside the resource, in a stable order
+	if len(eventContext.sourceValues.body) > 0 {
+		body := make([]string, 0, len(eventContext.sourceValues.body))
+		for cfg, value := range eventContext.sourceValues.body {
+			body = append(body, cfg.JSONPath+"\x00"+cfg.Regex+"\x00"+value)
+		}
+		sort.Strings(body)
+		for _, value := range body {
+			buf = appendPart(buf, value)
+		}
+	}
+	if len(eventContext.sourceValues.metricName) > 0 {
+		metricName := make([]string, 0, len(eventContext.sourceValues.metricName))
+		for id, value := range eventContext.sourceValues.metricName {
+			metricName = append(metricName, id+"\x00"+value)
+		}
+		sort.Strings(metricName)
+		for _, value := range metricName {
+			buf = appendPart(buf, value)
+		}
+	}
+	return buf
+}
+
+// run restores the state of the context from the cache, or executes the
+// actions and stores their result
+func (c *metadataCache) run(eventContext *eventContext, actions []Action) {
+	buf := keyBuffers.Get().(*[]byte)
+	defer keyBuffers.Put(buf)
+	*buf = c.key((*buf)[:0], eventContext)
+	now := time.Now()
+	if entry, exists := c.get(*buf, now); exists {
+		c.hits.Add(eventContext.ctx, 1, c.attrs)
+		// The cached actions are the first ones, the metadata is empty. It is
+		// copied when a following action changes it, the values are never
+		// modified
+		eventContext.newMetadata = entry.metadata
+		eventContext.metadataShared = true
+		if len(entry.fanOutKeys) > 0 {
+			eventContext.fanOutKeys = append([]string(nil), entry.fanOutKeys...)
+		}
+		eventContext.err = entry.err
+		return
+	}
+	c.misses.Add(eventContext.ctx, 1, c.attrs)
+	for _, a := range actions {
+		a.execute(eventContext)
+		if eventContext.err != nil {
+			break
+		}
+	}
+	c.put(string(*buf), eventContext, now)
+}
+
+var keyBuffers = sync.Pool{
+	New: func() any {
+		buf := make([]byte, 0, 256)
+		return &buf
+	},
+}
+
+func (c *metadataCache) get(key []byte, now time.Time) (*cacheEntry, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	entry, exists := c.entries[string(key)]
+	if !exists {
+		return nil, false
+	}
+	if !now.Before(entry.expires) {
+		c.lru.Remove(entry.elem)
+		delete(c.entries, entry.key)
+		return nil, false
+	}
+	c.lru.MoveToFront(entry.elem)
+	return entry, true
+}
+
+func (c *metadataCache) put(key string, eventContext *eventContext, now time.Time) {
+	entry := &cacheEntry{
+		key:        key,
+		metadata:   make(map[string][]string, len(eventContext.newMetadata)),
+		fanOutKeys: append([]string(nil), eventContext.fanOutKeys...),
+		err:        eventContext.err,
+		expires:    now.Add(c.ttl),
+	}
+	if !eventContext.expires.IsZero() && eventContext.expires.Before(entry.expires) {
+		entry.expires = eventContext.expires
+	}
+	for k, v := range eventContext.newMetadata {
+		entry.metadata[k] = v
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if old, exists := c.entries[key]; exists {
+		c.lru.Remove(old.elem)
+	}
+	entry.elem = c.lru.PushFront(entry)
+	c.entries[key] = entry
+	if c.lru.Len() > c.maxEntries {
+		oldest := c.lru.Back().Value.(*cacheEntry)
+		c.lru.Remove(oldest.elem)
+		delete(c.entries, oldest.key)
+	}
+}
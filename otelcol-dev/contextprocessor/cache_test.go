@@ -0,0 +1,216 @@
+package contextprocessor
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/go-jose/go-jose/v4"
+	"github.com/go-jose/go-jose/v4/jwt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/collector/client"
+	"go.opentelemetry.io/collector/pdata/pcommon"
+	"go.opentelemetry.io/collector/processor/processortest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func newTestCacheConfig() *Config {
+	tenant := "x-scope-orgid"
+	anonymous := "anonymous"
+	team := "x-team"
+	return &Config{
+		ActionsConfig: []ActionConfig{
+			{
+				Key:           &tenant,
+				Action:        UPSERT,
+				ValueDefault:  &anonymous,
+				FromAttribute: AttributeNames{"tenant", "service.namespace", "k8s.namespace.name"},
+				Sanitize:      SANITIZE_MIMIR,
+			},
+		},
+		Rules: []RuleConfig{
+			{
+				Name:  "platform",
+				Match: MatchConfig{Attributes: map[string]string{"k8s.cluster.name": "platform"}},
+				ActionsConfig: []ActionConfig{
+					{Key: &team, Action: INSERT, FromAttribute: AttributeNames{"team"}},
+				},
+			},
+		},
+		SemconvAliases: true,
+		Cache:          &CacheConfig{},
+	}
+}
+
+// newTestRunner returns the actions of a processor with the configuration,
+// with or without its cache
+func newTestRunner(t testing.TB, cfg *Config, cached bool) *ActionsRunner {
+	if !cached {
+		uncached := *cfg
+		uncached.Cache = nil
+		cfg = &uncached
+	}
+	require.NoError(t, cfg.Validate())
+	ctxt, err := newContextProcessor(processortest.NewNopSettings(), trace.WithAttributes(), cfg, "log_records")
+	require.NoError(t, err)
+	return ctxt.actionsRunner
+}
+
+func TestCacheSameResult(t *testing.T) {
+	cfg := newTestCacheConfig()
+	uncached := newTestRunner(t, cfg, false)
+	cached := newTestRunner(t, cfg, true)
+
+	resources := []map[string]any{
+		{"tenant": "a", "k8s.cluster.name": "platform", "team": "x"},
+		{"tenant": "a", "k8s.cluster.name": "platform", "team": "y"},
+		{"tenant": "a", "k8s.cluster.name": "other", "team": "x"},
+		{"service.namespace": "b", "process.pid": 1},
+		{"service.namespace": "b", "process.pid": 2},
+		{"tenant": 42},
+		{"tenant": "42"},
+		{"tenant": "a:b"},
+		{},
+	}
+	// The second round is served by the cache
+	for round := 0; round < 2; round++ {
+		for i, attrs := range resources {
+			expected, err := uncached.Apply(context.Background(), newTestAttributes(attrs))
+			require.NoError(t, err)
+			actual, err := cached.Apply(context.Background(), newTestAttributes(attrs))
+			require.NoError(t, err)
+			require.Len(t, actual, len(expected))
+			for _, key := range []string{"x-scope-orgid", "x-team"} {
+				assert.Equal(t,
+					client.FromContext(expected[0]).Metadata.Get(key),
+					client.FromContext(actual[0]).Metadata.Get(key),
+					"resource %d round %d key %s", i, round, key)
+			}
+		}
+	}
+	// The attributes not read by the actions share the entry
+	assert.Equal(t, len(resources)-1, cached.cache.lru.Len())
+}
+
+func TestCacheMaxEntries(t *testing.T) {
+	cfg := newTestCacheConfig()
+	cfg.Cache.MaxEntries = 10
+	ar := newTestRunner(t, cfg, true)
+	for i := 0; i < 100; i++ {
+		_, err := ar.Apply(context.Background(), newTestAttributes(map[string]any{"tenant": strconv.Itoa(i)}))
+		require.NoError(t, err)
+	}
+	assert.Equal(t, 10, ar.cache.lru.Len())
+	assert.Len(t, ar.cache.entries, 10)
+}
+
+func TestCacheSharedMetadata(t *testing.T) {
+	cfg := newTestCacheConfig()
+	cfg.PublishKeys = true
+	cfg.CardinalityLimits = []CardinalityLimitConfig{{Key: "x-scope-orgid", MaxValues: 1}}
+	ar := newTestRunner(t, cfg, true)
+
+	for _, tenant := range []string{"a", "b", "a", "b"} {
+		ctxs, err := ar.Apply(context.Background(), newTestAttributes(map[string]any{"tenant": tenant}))
+		require.NoError(t, err)
+		require.Len(t, ctxs, 1)
+		metadata := client.FromContext(ctxs[0]).Metadata
+		assert.Equal(t, []string{"x-scope-orgid"}, metadata.Get(publishedKeysKey))
+		if tenant == "a" {
+			assert.Equal(t, []string{"a"}, metadata.Get("x-scope-orgid"))
+		} else {
+			assert.Equal(t, []string{defaultOverflowValue}, metadata.Get("x-scope-orgid"))
+		}
+	}
+	// The actions after the cache do not change the entries
+	require.Len(t, ar.cache.entries, 2)
+	for _, entry := range ar.cache.entries {
+		assert.NotContains(t, entry.metadata, publishedKeysKey)
+		assert.NotEqual(t, []string{defaultOverflowValue}, entry.metadata["x-scope-orgid"])
+	}
+}
+
+func TestCacheTokenExpiry(t *testing.T) {
+	cfg := newTestCacheConfig()
+	cfg.ActionsConfig[0].FromJWTClaim = &JWTClaimConfig{Claim: "tenant", InsecureSkipVerify: true}
+	cfg.Cache.TTL = time.Hour
+	ar := newTestRunner(t, cfg, true)
+
+	expiry := time.Now().Add(time.Minute).Truncate(time.Second)
+	token := signTestToken(t, jose.HS256, testJWTSecret, "", map[string]any{"tenant": "shop", "exp": expiry.Unix()})
+	ctxs, err := ar.Apply(newTestJWTContext(token), newTestAttributes(nil))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"shop"}, client.FromContext(ctxs[0]).Metadata.Get("x-scope-orgid"))
+	// Without exp claim the TTL is used
+	token = signTestToken(t, jose.HS256, testJWTSecret, "", map[string]any{"tenant": "web"})
+	_, err = ar.Apply(newTestJWTContext(token), newTestAttributes(nil))
+	require.NoError(t, err)
+
+	require.Equal(t, 2, ar.cache.lru.Len())
+	assert.True(t, ar.cache.lru.Back().Value.(*cacheEntry).expires.Equal(expiry))
+	assert.True(t, ar.cache.lru.Front().Value.(*cacheEntry).expires.After(time.Now().Add(59*time.Minute)))
+	_, exists := ar.cache.get([]byte(ar.cache.lru.Back().Value.(*cacheEntry).key), expiry)
+	assert.False(t, exists)
+	assert.Equal(t, 1, ar.cache.lru.Len())
+}
+
+func benchmarkApply(b *testing.B, cached bool) {
+	attrs := newTestAttributes(map[string]any{
+		"service.name":       "checkout",
+		"service.namespace":  "shop",
+		"k8s.namespace.name": "shop-prod",
+		"k8s.cluster.name":   "platform",
+		"team":               "payments",
+		"host.name":          "node-1",
+	})
+	b.Run("attributes", func(b *testing.B) {
+		ar := newTestRunner(b, newTestCacheConfig(), cached)
+		ctx := client.NewContext(context.Background(), client.Info{
+			Metadata: client.NewMetadata(map[string][]string{"x-team": {"payments"}}),
+		})
+		runApply(b, ar, ctx, attrs)
+	})
+	b.Run("jwt", func(b *testing.B) {
+		secret := []byte("0123456789abcdef0123456789abcdef")
+		keyFile := filepath.Join(b.TempDir(), "secret")
+		require.NoError(b, os.WriteFile(keyFile, secret, 0o600))
+		cfg := newTestCacheConfig()
+		cfg.ActionsConfig[0].FromJWTClaim = &JWTClaimConfig{Claim: "tenant", KeyFile: keyFile}
+		signer, err := jose.NewSigner(jose.SigningKey{Algorithm: jose.HS256, Key: secret}, nil)
+		require.NoError(b, err)
+		token, err := jwt.Signed(signer).Claims(map[string]any{
+			"tenant": "shop",
+			"exp":    time.Now().Add(time.Hour).Unix(),
+		}).Serialize()
+		require.NoError(b, err)
+		ar := newTestRunner(b, cfg, cached)
+		ctx := client.NewContext(context.Background(), client.Info{
+			Metadata: client.NewMetadata(map[string][]string{"authorization": {"Bearer " + token}}),
+		})
+		runApply(b, ar, ctx, attrs)
+	})
+}
+
+func runApply(b *testing.B, ar *ActionsRunner, ctx context.Context, attrs pcommon.Map) {
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := ar.Apply(ctx, attrs); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkApplyCold resolves the metadata with the actions every time
+func BenchmarkApplyCold(b *testing.B) {
+	benchmarkApply(b, false)
+}
+
+// BenchmarkApplyWarm takes the metadata from the cache
+func BenchmarkApplyWarm(b *testing.B) {
+	benchmarkApply(b, true)
+}
@@ -0,0 +1,138 @@
+package contextprocessor
+
+import (
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.uber.org/zap"
+)
+
+const (
+	// Value used once the max cardinality is reached
+	defaultOverflowValue = "__overflow__"
+	// Minimum period between two sweeps of expired values
+	cardinalitySweepInterval = time.Second
+)
+
+// cardinalityGuard is an Action which replaces the values of a metadata key
+// with the overflow value once too many distinct values have been seen
+type cardinalityGuard struct {
+	logger        *zap.Logger
+	key           string
+	maxValues     int
+	window        time.Duration
+	overflowValue string
+	attrs         metric.MeasurementOption
+	overflows     metric.Int64Counter
+	now           func() time.Time
+	mu            sync.Mutex
+	seen          map[string]time.Time
+	lastSweep     time.Time
+	overflowing   bool
+}
+
+func newCardinalityGuard(
+	logger *zap.Logger,
+	meter metric.Meter,
+	processor attribute.KeyValue,
+	cfg CardinalityLimitConfig) (*cardinalityGuard, error) {
+
+	overflows, err := meter.Int64Counter(
+		"processor_context_cardinality_overflows",
+		metric.WithDescription("Number of metadata values replaced by the overflow value"),
+		metric.WithUnit("{values}"),
+	)
+	if err != nil {
+		return nil, err
+	}
+	overflowValue := cfg.OverflowValue
+	if overflowValue == "" {
+		overflowValue = defaultOverflowValue
+	}
+	return &cardinalityGuard{
+		logger:        logger,
+		key:           cfg.Key,
+		maxValues:     cfg.MaxValues,
+		window:        cfg.Window,
+		overflowValue: overflowValue,
+		attrs:         metric.WithAttributes(processor, attribute.String("key", cfg.Key)),
+		overflows:     overflows,
+		now:           time.Now,
+		seen:          make(map[string]time.Time),
+	}, nil
+}
+
+// removes the values not seen during the window, must be called with the lock
+func (g *cardinalityGuard) sweep(now time.Time) {
+	if g.window == 0 || now.Sub(g.lastSweep) < cardinalitySweepInterval {
+		return
+	}
+	for value, last := range g.seen {
+		if now.Sub(last) > g.window {
+			delete(g.seen, value)
+		}
+	}
+	g.lastSweep = now
+}
+
+// admit returns the value to use, which is the overflow value if there is no
+// room for a new value
+func (g *cardinalityGuard) admit(value string, now time.Time) string {
+	if _, exists := g.seen[value]; exists {
+		g.seen[value] = now
+		return value
+	}
+	if len(g.seen) >= g.maxValues {
+		g.sweep(now)
+	}
+	if len(g.seen) < g.maxValues {
+		if g.overflowing {
+			g.logger.Info("Metadata cardinality back under the limit", zap.String("key", g.key))
+			g.overflowing = false
+		}
+		g.seen[value] = now
+		return value
+	}
+	if !g.overflowing {
+		g.logger.Warn("Metadata cardinality limit reached, new values are replaced",
+			zap.String("key", g.key),
+			zap.Int("max_values", g.maxValues),
+			zap.String("overflow_value", g.overflowValue))
+		g.overflowing = true
+	}
+	return g.overflowValue
+}
+
+func (g *cardinalityGuard) execute(eventContext *eventContext) {
+	values, exists := eventContext.getContextKey(g.key)
+	if !exists {
+		return
+	}
+	overflows := 0
+	hasOverflow := false
+	g.mu.Lock()
+	now := g.now()
+	guarded := make([]string, 0, len(values))
+	for _, value := range values {
+		if value != g.overflowValue {
+			if value = g.admit(value, now); value == g.overflowValue {
+				overflows++
+			}
+		}
+		// The overflow value is only added once
+		if value == g.overflowValue {
+			if hasOverflow {
+				continue
+			}
+			hasOverflow = true
+		}
+		guarded = append(guarded, value)
+	}
+	g.mu.Unlock()
+	if overflows > 0 {
+		g.overflows.Add(eventContext.ctx, int64(overflows), g.attrs)
+		eventContext.setContextKey(g.key, guarded)
+	}
+}
@@ -0,0 +1,77 @@
+package contextprocessor
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+// guardValues executes the guard with the values of the key and returns the
+// values once guarded
+func guardValues(g *cardinalityGuard, values ...string) []string {
+	eventContext := newEventContext()
+	eventContext.setContextKey(g.key, values)
+	g.execute(eventContext)
+	guarded, _ := eventContext.getContextKey(g.key)
+	return guarded
+}
+
+func TestCardinalityGuard(t *testing.T) {
+	meter, reader := newTestMetricReader()
+	g, err := newCardinalityGuard(zap.NewNop(), meter, newTestProcessorID(),
+		CardinalityLimitConfig{Key: "x-scope-orgid", MaxValues: 2})
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"a"}, guardValues(g, "a"))
+	assert.Equal(t, []string{"b", "a"}, guardValues(g, "b", "a"))
+	assert.Nil(t, collectSum(t, reader, "processor_context_cardinality_overflows"))
+	// Past the cap the new values are replaced, the overflow value only once
+	assert.Equal(t, []string{defaultOverflowValue}, guardValues(g, "c"))
+	assert.Equal(t, []string{"a", defaultOverflowValue}, guardValues(g, "a", "c", "d"))
+	// The overflow value received does not use a slot nor counts as rejected
+	assert.Equal(t, []string{defaultOverflowValue, "b"}, guardValues(g, defaultOverflowValue, "b"))
+	assert.Len(t, g.seen, 2)
+
+	points := collectSum(t, reader, "processor_context_cardinality_overflows")
+	require.Len(t, points, 1)
+	assert.Equal(t, int64(3), points[0].Value)
+	key, _ := points[0].Attributes.Value("key")
+	assert.Equal(t, "x-scope-orgid", key.AsString())
+}
+
+func TestCardinalityGuardOverflowValue(t *testing.T) {
+	g, err := newCardinalityGuard(zap.NewNop(), newTestMeter(), newTestProcessorID(),
+		CardinalityLimitConfig{Key: "x-scope-orgid", MaxValues: 1, OverflowValue: "other"})
+	require.NoError(t, err)
+	// The configured overflow value received first does not use the slot
+	assert.Equal(t, []string{"other"}, guardValues(g, "other"))
+	assert.Equal(t, []string{"a"}, guardValues(g, "a"))
+	assert.Equal(t, []string{"other"}, guardValues(g, "b"))
+}
+
+func TestCardinalityGuardWindow(t *testing.T) {
+	g, err := newCardinalityGuard(zap.NewNop(), newTestMeter(), newTestProcessorID(),
+		CardinalityLimitConfig{Key: "x-scope-orgid", MaxValues: 2, Window: time.Minute})
+	require.NoError(t, err)
+	now := time.Now()
+	g.now = func() time.Time { return now }
+
+	assert.Equal(t, []string{"a"}, guardValues(g, "a"))
+	assert.Equal(t, []string{"b"}, guardValues(g, "b"))
+	assert.Equal(t, []string{defaultOverflowValue}, guardValues(g, "c"))
+
+	// a is seen again, b expires
+	now = now.Add(40 * time.Second)
+	assert.Equal(t, []string{"a"}, guardValues(g, "a"))
+	now = now.Add(30 * time.Second)
+	assert.Equal(t, []string{"c"}, guardValues(g, "c"))
+	assert.Equal(t, []string{defaultOverflowValue}, guardValues(g, "b"))
+
+	// All the values expired, only the new one is remembered
+	now = now.Add(2 * time.Minute)
+	assert.Equal(t, []string{"d"}, guardValues(g, "d"))
+	assert.Len(t, g.seen, 1)
+}
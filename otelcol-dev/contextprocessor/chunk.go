@@ -0,0 +1,203 @@
+package contextprocessor
+
+import (
+	"go.opentelemetry.io/collector/pdata/plog"
+	"go.opentelemetry.io/collector/pdata/pmetric"
+	"go.opentelemetry.io/collector/pdata/ptrace"
+)
+
+// splitAt returns the number of items to move to a new chunk, or 0 if the
+// payload is within max_items and max_bytes. The size is only calculated
+// with max_bytes, payloads too big are split in halves. A single item is
+// never split.
+func (ctxt *contextProcessor) splitAt(items int, size func() int) int {
+	switch {
+	case items <= 1:
+		return 0
+	case ctxt.maxItems > 0 && items > ctxt.maxItems:
+		return ctxt.maxItems
+	case ctxt.maxBytes > 0 && size() > ctxt.maxBytes:
+		return items / 2
+	}
+	return 0
+}
+
+// chunked returns true if the payloads have to be split
+func (ctxt *contextProcessor) chunked() bool {
+	return ctxt.maxItems > 0 || ctxt.maxBytes > 0
+}
+
+// chunkOrder splits the payload 0 within max_items and max_bytes and returns
+// the indexes of the chunks in order. items and size measure the payload of
+// an index, split moves its first n items to a new payload and returns its
+// index.
+func (ctxt *contextProcessor) chunkOrder(items, size func(int) int, split func(int, int) int) []int {
+	order := make([]int, 0, 1)
+	pending := []int{0}
+	for len(pending) > 0 {
+		last := len(pending) - 1
+		p := pending[last]
+		n := ctxt.splitAt(items(p), func() int { return size(p) })
+		if n == 0 {
+			order = append(order, p)
+			pending = pending[:last]
+			continue
+		}
+		// The first items are checked again before the rest
+		pending = append(pending, split(p, n))
+	}
+	return order
+}
+
+// splitLogs moves the first n log records of the resource to a new payload,
+// with the same resource and scopes
+func splitLogs(ld plog.Logs, n int) plog.Logs {
+	head := plog.NewLogs()
+	rl := ld.ResourceLogs().At(0)
+	headRl := head.ResourceLogs().AppendEmpty()
+	rl.Resource().CopyTo(headRl.Resource())
+	headRl.SetSchemaUrl(rl.SchemaUrl())
+	moved := 0
+	sls := rl.ScopeLogs()
+	for i := 0; i < sls.Len() && n > 0; i++ {
+		sl := sls.At(i)
+		headSl := headRl.ScopeLogs().AppendEmpty()
+		sl.Scope().CopyTo(headSl.Scope())
+		headSl.SetSchemaUrl(sl.SchemaUrl())
+		sl.LogRecords().RemoveIf(func(lr plog.LogRecord) bool {
+			if n == 0 {
+				return false
+			}
+			lr.MoveTo(headSl.LogRecords().AppendEmpty())
+			n--
+			return true
+		})
+		if sl.LogRecords().Len() == 0 {
+			moved++
+		}
+	}
+	removeFirst(moved, func(f func() bool) { sls.RemoveIf(func(plog.ScopeLogs) bool { return f() }) })
+	return head
+}
+
+// splitTraces moves the first n spans of the resource to a new payload, with
+// the same resource and scopes
+func splitTraces(td ptrace.Traces, n int) ptrace.Traces {
+	head := ptrace.NewTraces()
+	rt := td.ResourceSpans().At(0)
+	headRt := head.ResourceSpans().AppendEmpty()
+	rt.Resource().CopyTo(headRt.Resource())
+	headRt.SetSchemaUrl(rt.SchemaUrl())
+	moved := 0
+	sss := rt.ScopeSpans()
+	for i := 0; i < sss.Len() && n > 0; i++ {
+		ss := sss.At(i)
+		headSs := headRt.ScopeSpans().AppendEmpty()
+		ss.Scope().CopyTo(headSs.Scope())
+		headSs.SetSchemaUrl(ss.SchemaUrl())
+		ss.Spans().RemoveIf(func(span ptrace.Span) bool {
+			if n == 0 {
+				return false
+			}
+			span.MoveTo(headSs.Spans().AppendEmpty())
+			n--
+			return true
+		})
+		if ss.Spans().Len() == 0 {
+			moved++
+		}
+	}
+	removeFirst(moved, func(f func() bool) { sss.RemoveIf(func(ptrace.ScopeSpans) bool { return f() }) })
+	return head
+}
+
+// splitMetrics moves the first n data points of the resource to a new
+// payload, with the same resource and scopes. A metric with data points in
+// both payloads is copied without them.
+func splitMetrics(md pmetric.Metrics, n int) pmetric.Metrics {
+	head := pmetric.NewMetrics()
+	rm := md.ResourceMetrics().At(0)
+	headRm := head.ResourceMetrics().AppendEmpty()
+	rm.Resource().CopyTo(headRm.Resource())
+	headRm.SetSchemaUrl(rm.SchemaUrl())
+	moved := 0
+	sms := rm.ScopeMetrics()
+	for i := 0; i < sms.Len() && n > 0; i++ {
+		sm := sms.At(i)
+		headSm := headRm.ScopeMetrics().AppendEmpty()
+		sm.Scope().CopyTo(headSm.Scope())
+		headSm.SetSchemaUrl(sm.SchemaUrl())
+		sm.Metrics().RemoveIf(func(metric pmetric.Metric) bool {
+			if n == 0 {
+				return false
+			}
+			points := dataPointCount(metric)
+			if points <= n {
+				metric.MoveTo(headSm.Metrics().AppendEmpty())
+				n -= points
+				return true
+			}
+			headMetric := headSm.Metrics().AppendEmpty()
+			metric.CopyTo(headMetric)
+			keepDataPoints(headMetric, 0, n)
+			keepDataPoints(metric, n, points)
+			n = 0
+			return false
+		})
+		if sm.Metrics().Len() == 0 {
+			moved++
+		}
+	}
+	removeFirst(moved, func(f func() bool) { sms.RemoveIf(func(pmetric.ScopeMetrics) bool { return f() }) })
+	return head
+}
+
+// removeFirst removes the first n elements with removeIf, the scopes moved
+// to the new payload
+func removeFirst(n int, removeIf func(func() bool)) {
+	if n == 0 {
+		return
+	}
+	removed := 0
+	removeIf(func() bool {
+		removed++
+		return removed <= n
+	})
+}
+
+func dataPointCount(metric pmetric.Metric) int {
+	switch metric.Type() {
+	case pmetric.MetricTypeGauge:
+		return metric.Gauge().DataPoints().Len()
+	case pmetric.MetricTypeSum:
+		return metric.Sum().DataPoints().Len()
+	case pmetric.MetricTypeHistogram:
+		return metric.Histogram().DataPoints().Len()
+	case pmetric.MetricTypeExponentialHistogram:
+		return metric.ExponentialHistogram().DataPoints().Len()
+	case pmetric.MetricTypeSummary:
+		return metric.Summary().DataPoints().Len()
+	}
+	return 0
+}
+
+// keepDataPoints removes the data points of the metric out of [from, to)
+func keepDataPoints(metric pmetric.Metric, from, to int) {
+	i := -1
+	outside := func() bool {
+		i++
+		return i < from || i >= to
+	}
+	switch metric.Type() {
+	case pmetric.MetricTypeGauge:
+		metric.Gauge().DataPoints().RemoveIf(func(pmetric.NumberDataPoint) bool { return outside() })
+	case pmetric.MetricTypeSum:
+		metric.Sum().DataPoints().RemoveIf(func(pmetric.NumberDataPoint) bool { return outside() })
+	case pmetric.MetricTypeHistogram:
+		metric.Histogram().DataPoints().RemoveIf(func(pmetric.HistogramDataPoint) bool { return outside() })
+	case pmetric.MetricTypeExponentialHistogram:
+		metric.ExponentialHistogram().DataPoints().RemoveIf(func(pmetric.ExponentialHistogramDataPoint) bool { return outside() })
+	case pmetric.MetricTypeSummary:
+		metric.Summary().DataPoints().RemoveIf(func(pmetric.SummaryDataPoint) bool { return outside() })
+	}
+}
@@ -0,0 +1,208 @@
+package contextprocessor
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/collector/pdata/plog"
+	"go.opentelemetry.io/collector/pdata/pmetric"
+)
+
+// newTestMetrics returns a resource with a scope for each list of metrics,
+// with the given number of gauge data points named after their position
+func newTestMetrics(scopes ...[]int) pmetric.Metrics {
+	md := pmetric.NewMetrics()
+	rm := md.ResourceMetrics().AppendEmpty()
+	rm.Resource().Attributes().PutStr("tenant", "team-a")
+	rm.SetSchemaUrl("https://opentelemetry.io/schemas/1.26.0")
+	for i, points := range scopes {
+		sm := rm.ScopeMetrics().AppendEmpty()
+		sm.Scope().SetName(string(rune('a' + i)))
+		for j, n := range points {
+			metric := sm.Metrics().AppendEmpty()
+			metric.SetName(string(rune('a'+i)) + string(rune('0'+j)))
+			dps := metric.SetEmptyGauge().DataPoints()
+			for k := 0; k < n; k++ {
+				dps.AppendEmpty().SetIntValue(int64(k))
+			}
+		}
+	}
+	return md
+}
+
+// metricPoints returns the data point values by scope and metric name
+func metricPoints(md pmetric.Metrics) map[string]map[string][]int64 {
+	result := make(map[string]map[string][]int64)
+	sms := md.ResourceMetrics().At(0).ScopeMetrics()
+	for i := 0; i < sms.Len(); i++ {
+		metrics := make(map[string][]int64)
+		for j := 0; j < sms.At(i).Metrics().Len(); j++ {
+			metric := sms.At(i).Metrics().At(j)
+			values := []int64{}
+			for k := 0; k < metric.Gauge().DataPoints().Len(); k++ {
+				values = append(values, metric.Gauge().DataPoints().At(k).IntValue())
+			}
+			metrics[metric.Name()] = values
+		}
+		result[sms.At(i).Scope().Name()] = metrics
+	}
+	return result
+}
+
+func TestSplitMetrics(t *testing.T) {
+	md := newTestMetrics([]int{2, 3}, []int{1})
+	head := splitMetrics(md, 3)
+
+	assert.Equal(t, 3, head.DataPointCount())
+	assert.Equal(t, 3, md.DataPointCount())
+	// The metric split across both payloads keeps its data points in order
+	assert.Equal(t, map[string]map[string][]int64{
+		"a": {"a0": {0, 1}, "a1": {0}},
+	}, metricPoints(head))
+	assert.Equal(t, map[string]map[string][]int64{
+		"a": {"a1": {1, 2}},
+		"b": {"b0": {0}},
+	}, metricPoints(md))
+	rm := head.ResourceMetrics().At(0)
+	assert.Equal(t, md.ResourceMetrics().At(0).SchemaUrl(), rm.SchemaUrl())
+	tenant, _ := rm.Resource().Attributes().Get("tenant")
+	assert.Equal(t, "team-a", tenant.Str())
+}
+
+func TestSplitMetricsScopes(t *testing.T) {
+	// The first scope is moved, the second is split
+	md := newTestMetrics([]int{1}, []int{1, 1})
+	head := splitMetrics(md, 2)
+	assert.Equal(t, map[string]map[string][]int64{
+		"a": {"a0": {0}},
+		"b": {"b0": {0}},
+	}, metricPoints(head))
+	assert.Equal(t, map[string]map[string][]int64{
+		"b": {"b1": {0}},
+	}, metricPoints(md))
+
+	// Empty scopes before the data points are moved with them
+	md = newTestMetrics([]int{}, []int{2}, []int{}, []int{1})
+	head = splitMetrics(md, 2)
+	assert.Equal(t, map[string]map[string][]int64{
+		"a": {},
+		"b": {"b0": {0, 1}},
+	}, metricPoints(head))
+	assert.Equal(t, map[string]map[string][]int64{
+		"c": {},
+		"d": {"d0": {0}},
+	}, metricPoints(md))
+}
+
+func TestKeepDataPoints(t *testing.T) {
+	md := newTestMetrics([]int{5})
+	metric := md.ResourceMetrics().At(0).ScopeMetrics().At(0).Metrics().At(0)
+	keepDataPoints(metric, 1, 4)
+	assert.Equal(t, map[string]map[string][]int64{"a": {"a0": {1, 2, 3}}}, metricPoints(md))
+
+	// Each type of metric keeps the second data point
+	for name, newMetric := range map[string]func(pmetric.Metric){
+		"sum": func(m pmetric.Metric) {
+			m.SetEmptySum().DataPoints().AppendEmpty()
+			m.Sum().DataPoints().AppendEmpty().SetIntValue(1)
+		},
+		"histogram": func(m pmetric.Metric) {
+			m.SetEmptyHistogram().DataPoints().AppendEmpty()
+			m.Histogram().DataPoints().AppendEmpty().SetCount(1)
+		},
+		"exponential histogram": func(m pmetric.Metric) {
+			m.SetEmptyExponentialHistogram().DataPoints().AppendEmpty()
+			m.ExponentialHistogram().DataPoints().AppendEmpty().SetCount(1)
+		},
+		"summary": func(m pmetric.Metric) {
+			m.SetEmptySummary().DataPoints().AppendEmpty()
+			m.Summary().DataPoints().AppendEmpty().SetCount(1)
+		},
+	} {
+		metric := pmetric.NewMetric()
+		newMetric(metric)
+		require.Equal(t, 2, dataPointCount(metric), name)
+		keepDataPoints(metric, 1, 2)
+		assert.Equal(t, 1, dataPointCount(metric), name)
+		switch metric.Type() {
+		case pmetric.MetricTypeSum:
+			assert.Equal(t, int64(1), metric.Sum().DataPoints().At(0).IntValue())
+		case pmetric.MetricTypeHistogram:
+			assert.Equal(t, uint64(1), metric.Histogram().DataPoints().At(0).Count())
+		case pmetric.MetricTypeExponentialHistogram:
+			assert.Equal(t, uint64(1), metric.ExponentialHistogram().DataPoints().At(0).Count())
+		case pmetric.MetricTypeSummary:
+			assert.Equal(t, uint64(1), metric.Summary().DataPoints().At(0).Count())
+		}
+	}
+}
+
+func TestRemoveFirst(t *testing.T) {
+	for _, n := range []int{0, 2, 5} {
+		sls := plog.NewScopeLogsSlice()
+		for i := 0; i < 4; i++ {
+			sls.AppendEmpty().Scope().SetName(string(rune('a' + i)))
+		}
+		removeFirst(n, func(f func() bool) { sls.RemoveIf(func(plog.ScopeLogs) bool { return f() }) })
+		names := []string{}
+		for i := 0; i < sls.Len(); i++ {
+			names = append(names, sls.At(i).Scope().Name())
+		}
+		expected := []string{"a", "b", "c", "d"}
+		if n < len(expected) {
+			expected = expected[n:]
+		} else {
+			expected = []string{}
+		}
+		assert.Equal(t, expected, names, n)
+	}
+}
+
+func TestChunksMaxItems(t *testing.T) {
+	ctxt := &contextMetricsProcessor{sizer: &pmetric.ProtoMarshaler{}}
+	md := newTestMetrics([]int{2, 3}, []int{2})
+	// Without limits the payload is not split
+	require.Len(t, ctxt.chunks(md), 1)
+
+	ctxt.maxItems = 7
+	require.Len(t, ctxt.chunks(newTestMetrics([]int{2, 3}, []int{2})), 1)
+	ctxt.maxItems = 3
+	chunks := ctxt.chunks(md)
+	require.Len(t, chunks, 3)
+	assert.Equal(t, map[string]map[string][]int64{"a": {"a0": {0, 1}, "a1": {0}}}, metricPoints(chunks[0]))
+	assert.Equal(t, map[string]map[string][]int64{"a": {"a1": {1, 2}}, "b": {"b0": {0}}}, metricPoints(chunks[1]))
+	assert.Equal(t, map[string]map[string][]int64{"b": {"b0": {1}}}, metricPoints(chunks[2]))
+}
+
+func TestChunksMaxBytes(t *testing.T) {
+	sizer := &pmetric.ProtoMarshaler{}
+	md := newTestMetrics([]int{4, 4})
+	size := sizer.MetricsSize(md)
+
+	ctxt := &contextMetricsProcessor{sizer: sizer}
+	ctxt.maxBytes = size
+	require.Len(t, ctxt.chunks(md), 1)
+	ctxt.maxBytes = size - 1
+	// The chunks take the data points of the payload
+	chunks := ctxt.chunks(md)
+	require.Len(t, chunks, 2)
+	for _, chunk := range chunks {
+		assert.Equal(t, 4, chunk.DataPointCount())
+		assert.LessOrEqual(t, sizer.MetricsSize(chunk), ctxt.maxBytes)
+	}
+	// A single data point is never split
+	ctxt.maxBytes = 1
+	chunks = ctxt.chunks(newTestMetrics([]int{4, 4}))
+	require.Len(t, chunks, 8)
+	values := []int64{}
+	for _, chunk := range chunks {
+		assert.Equal(t, 1, chunk.DataPointCount())
+		for _, metrics := range metricPoints(chunk) {
+			for _, points := range metrics {
+				values = append(values, points...)
+			}
+		}
+	}
+	assert.Equal(t, []int64{0, 1, 2, 3, 0, 1, 2, 3}, values)
+}
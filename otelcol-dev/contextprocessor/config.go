@@ -2,20 +2,333 @@ package contextprocessor
 
 import (
 	"fmt"
+	"regexp"
+	"strings"
+	"time"
 )
 
 var (
-	errMissingActionConfig       = fmt.Errorf("missing actions configuration")
-	errMissingActionConfigKey    = fmt.Errorf("missing action key")
-	errMissingActionConfigSource = fmt.Errorf("missing action source, must be 'from_attribute' or 'value'")
-	errMissingActionDeleteParams = fmt.Errorf("action delete does not support 'from_attribute' and/or 'value'")
+	errMissingActionConfig         = fmt.Errorf("missing actions or rules configuration")
+	errMissingActionConfigKey      = fmt.Errorf("missing action key")
+	errMissingActionConfigSource   = fmt.Errorf("missing action source, must be 'from_attribute', 'from_jwt_claim', 'from_body', 'from_metric_name', 'value' or 'values'")
+	errMissingActionDeleteParams   = fmt.Errorf("action delete does not support 'from_attribute', 'from_jwt_claim', 'from_body', 'from_metric_name', 'value' and/or 'remove_source'")
+	errInvalidUsageCardinality     = fmt.Errorf("usage 'max_cardinality' cannot be negative")
+	errMissingRateLimitKey         = fmt.Errorf("missing rate_limit 'metadata_key'")
+	errInvalidRateLimitMode        = fmt.Errorf("unknown rate_limit mode, must be 'drop' or 'reject'")
+	errInvalidRateLimit            = fmt.Errorf("rate_limit 'rate' and 'burst' cannot be negative")
+	errInvalidRateLimitCardinality = fmt.Errorf("rate_limit 'max_cardinality' cannot be negative")
+	errMissingCardinalityKey       = fmt.Errorf("missing cardinality limit 'key'")
+	errInvalidCardinalityLimit     = fmt.Errorf("cardinality limit 'max_values' must be positive and 'window' cannot be negative")
+	errMissingValidationRules      = fmt.Errorf("validation requires 'allow', 'deny', 'regex' and/or 'file'")
+	errInvalidValidationPolicy     = fmt.Errorf("unknown validation 'on_invalid', must be 'fallback', 'drop' or 'reject'")
+	errMissingValidationFallback   = fmt.Errorf("validation 'on_invalid: fallback' (default) requires 'fallback'")
+	errInvalidDeleteValidation     = fmt.Errorf("action delete does not support 'validation'")
+	errInvalidSanitizePreset       = fmt.Errorf("unknown 'sanitize', must be 'mimir', 'loki', 'tempo' or 'cortex'")
+	errInvalidSanitizeMode         = fmt.Errorf("unknown 'sanitize_mode', must be 'normalize' or 'reject'")
+	errInvalidDeleteSanitize       = fmt.Errorf("action delete does not support 'sanitize'")
+	errInvalidPreset               = fmt.Errorf("unknown 'preset', must be 'grafana-lgtm', 'mimir', 'loki', 'tempo', 'cortex' or 'splunk'")
+	errMissingPresetTenantFrom     = fmt.Errorf("'preset' requires 'tenant_from'")
+	errMissingPreset               = fmt.Errorf("'tenant_from' and 'tenant_default' require 'preset'")
+	errMissingRuleActions          = fmt.Errorf("missing rule actions")
+	errMissingRemoveSourceAttr     = fmt.Errorf("'remove_source' requires 'from_attribute'")
+	errMissingEnrichmentKey        = fmt.Errorf("missing enrichment 'metadata_key'")
+	errMissingEnrichmentFile       = fmt.Errorf("missing enrichment 'file'")
+	errMissingEnrichmentAttrs      = fmt.Errorf("missing enrichment 'attributes'")
+	errInvalidEnrichmentAttr       = fmt.Errorf("enrichment attribute requires 'name' and 'action' must be 'insert', 'update' or 'upsert'")
+	errInvalidFanOutAction         = fmt.Errorf("'fan_out' is only supported by the actions insert and upsert")
+	errInvalidFanOutValues         = fmt.Errorf("'values' requires 'fan_out'")
+	errInvalidMaxFanOut            = fmt.Errorf("'max_fan_out' cannot be negative")
+	errMissingCredentialsKey       = fmt.Errorf("missing credentials 'metadata_key'")
+	errMissingCredentialsSource    = fmt.Errorf("credentials require 'file' and/or 'env'")
+	errMissingJWTClaim             = fmt.Errorf("missing from_jwt_claim 'claim'")
+	errInvalidJWTVerification      = fmt.Errorf("from_jwt_claim requires only one of 'jwks_file', 'key_file' or 'insecure_skip_verify'")
+	errMissingBodySource           = fmt.Errorf("from_body requires 'json_path' and/or 'regex'")
+	errInvalidMetricNameMapping    = fmt.Errorf("from_metric_name requires 'value' and only one of 'prefix' or 'regex'")
+	errInvalidMetadataKey          = fmt.Errorf("invalid metadata key, it must be a valid HTTP header and gRPC metadata name: letters, digits, '-', '_' and '.', not starting with 'grpc-'")
+	errInvalidAttributeAliases     = fmt.Errorf("an attribute can only be in one of 'attribute_aliases'")
+	errInvalidMetadataLimits       = fmt.Errorf("metadata_limits 'max_value_length', 'max_values' and 'max_total_bytes' cannot be negative")
+	errInvalidLimitPolicy          = fmt.Errorf("unknown metadata_limits 'policy', must be 'truncate', 'drop' or 'reject'")
+	errMissingTraceKey             = fmt.Errorf("missing trace_consistency 'metadata_key'")
+	errInvalidTraceMode            = fmt.Errorf("unknown trace_consistency mode, must be 'root' or 'first_seen'")
+	errInvalidTraceLimits          = fmt.Errorf("trace_consistency 'max_traces', 'ttl' and 'decision_wait' cannot be negative")
+	errInvalidDecisionWait         = fmt.Errorf("trace_consistency 'decision_wait' requires mode 'root'")
+	errInvalidConcurrency          = fmt.Errorf("'concurrency' cannot be negative")
+	errInvalidChunkLimits          = fmt.Errorf("'max_items' and 'max_bytes' cannot be negative")
+	errInvalidTimeout              = fmt.Errorf("'timeout' cannot be negative")
+	errInvalidCache                = fmt.Errorf("cache 'max_entries' and 'ttl' cannot be negative")
+	errInvalidCacheRemoveSource    = fmt.Errorf("'cache' does not support actions with 'remove_source'")
 )
 
 // Config represents the receiver config settings within the collector's config.yaml
 type Config struct {
+	// Preset expands into the actions needed by a backend, see presets.go
+	Preset        Preset           `mapstructure:"preset"`
+	TenantFrom    AttributeNames   `mapstructure:"tenant_from"`
+	TenantDefault *string          `mapstructure:"tenant_default"`
+	ActionsConfig []ActionConfig   `mapstructure:"actions"`
+	Usage         UsageConfig      `mapstructure:"usage"`
+	RateLimit     *RateLimitConfig `mapstructure:"rate_limit"`
+	// Rules are evaluated after the actions, only the first matching one is applied
+	Rules []RuleConfig `mapstructure:"rules"`
+	// CardinalityLimits are applied to the metadata after all the actions
+	CardinalityLimits []CardinalityLimitConfig `mapstructure:"cardinality_limits"`
+	// Enrichment adds resource attributes from a registry of tenants
+	Enrichment *EnrichmentConfig `mapstructure:"enrichment"`
+	// Credentials sets the authorization metadata of the tenant
+	Credentials *CredentialsConfig `mapstructure:"credentials"`
+	// TraceConsistency assigns all the spans of a trace the same value of a
+	// metadata key, only used with traces
+	TraceConsistency *TraceConsistencyConfig `mapstructure:"trace_consistency"`
+	// SemconvAliases resolves the attributes renamed by the semantic conventions
+	// with any of their names, the schema URL of the resource decides the preferred
+	SemconvAliases bool `mapstructure:"semconv_aliases"`
+	// AttributeAliases maps attributes to their other names, the attribute is
+	// preferred and then the aliases in order
+	AttributeAliases map[string][]string `mapstructure:"attribute_aliases"`
+	// EmptyAsMissing treats empty, whitespace-only and null values as missing in
+	// all the actions, unless the action defines it
+	EmptyAsMissing bool `mapstructure:"empty_as_missing"`
+	// MetadataLimits caps the size of the metadata set by the actions
+	MetadataLimits *MetadataLimitsConfig `mapstructure:"metadata_limits"`
+	// Cache remembers the metadata set by the actions and rules for the
+	// resources with the same attributes and incoming metadata
+	Cache *CacheConfig `mapstructure:"cache"`
+	// PublishKeys adds the metadata key context-metadata-keys with the list of
+	// keys set, used by the metadata_headers extension
+	PublishKeys bool `mapstructure:"publish_keys"`
+	// Concurrency is the number of workers sending the payloads of a call to
+	// the next consumer concurrently, 0 or 1 sends them one by one
+	Concurrency int `mapstructure:"concurrency"`
+	// MaxItems splits the payloads sent to the next consumer in chunks of at
+	// most this number of items, 0 means no limit
+	MaxItems int `mapstructure:"max_items"`
+	// MaxBytes splits the payloads sent to the next consumer in chunks of at
+	// most this size in protobuf, 0 means no limit
+	MaxBytes int `mapstructure:"max_bytes"`
+	// Timeout is the deadline of each call to the next consumer, 0 means no
+	// deadline. A call over it returns a retryable error
+	Timeout time.Duration `mapstructure:"timeout"`
+	// TimeoutMetadataKey is the key with the tenant used as label of the
+	// timeouts metric
+	TimeoutMetadataKey string `mapstructure:"timeout_metadata_key"`
+	// MaxFanOut limits the number of copies of a resource generated by the
+	// fan_out actions, 0 means no limit
+	MaxFanOut int `mapstructure:"max_fan_out"`
+}
+
+// LimitPolicy defines what happens with the metadata over the limits
+type LimitPolicy string
+
+const (
+	// LIMIT_TRUNCATE shortens the values, or discards the values which do not
+	// fit (default)
+	LIMIT_TRUNCATE LimitPolicy = "truncate"
+	// LIMIT_DROP discards the data of the resource
+	LIMIT_DROP LimitPolicy = "drop"
+	// LIMIT_REJECT returns a permanent error to the previous component
+	LIMIT_REJECT LimitPolicy = "reject"
+)
+
+// MetadataLimitsConfig defines the limits of the metadata, 0 means no limit
+type MetadataLimitsConfig struct {
+	// MaxValueLength is the maximum number of bytes of a value
+	MaxValueLength int `mapstructure:"max_value_length"`
+	// MaxValues is the maximum number of values of a key
+	MaxValues int `mapstructure:"max_values"`
+	// MaxTotalBytes is the maximum size of all the keys and values
+	MaxTotalBytes int         `mapstructure:"max_total_bytes"`
+	Policy        LimitPolicy `mapstructure:"policy"`
+}
+
+// CacheConfig defines the size of the cache of the metadata resolved
+type CacheConfig struct {
+	// MaxEntries is the size of the cache, 10000 by default
+	MaxEntries int `mapstructure:"max_entries"`
+	// TTL is the period an entry is used since it was resolved, 1m by default
+	TTL time.Duration `mapstructure:"ttl"`
+}
+
+// TraceMode defines which span of a trace decides the value of the key
+type TraceMode string
+
+const (
+	// TRACE_ROOT uses the value of the root span, until it is seen the first
+	// one is used (default)
+	TRACE_ROOT TraceMode = "root"
+	// TRACE_FIRST_SEEN uses the value of the first span seen
+	TRACE_FIRST_SEEN TraceMode = "first_seen"
+)
+
+// TraceConsistencyConfig defines how to keep the value of a metadata key (the
+// tenant) for all the spans of a trace, remembering the traces in a cache
+type TraceConsistencyConfig struct {
+	MetadataKey string    `mapstructure:"metadata_key"`
+	Mode        TraceMode `mapstructure:"mode"`
+	// MaxTraces is the size of the cache, 100000 by default
+	MaxTraces int `mapstructure:"max_traces"`
+	// TTL is the period a trace is remembered since it was last seen, 5m by default
+	TTL time.Duration `mapstructure:"ttl"`
+	// DecisionWait holds the spans of a trace without root during this period,
+	// waiting for the root span. 0 (default) sends them without waiting
+	DecisionWait time.Duration `mapstructure:"decision_wait"`
+}
+
+// EnrichmentConfig defines the resource attributes taken from a registry file,
+// keyed by the value of a metadata key once all the actions are applied
+type EnrichmentConfig struct {
+	MetadataKey string `mapstructure:"metadata_key"`
+	// File in YAML (or JSON) with a map of tenants to attributes
+	File string `mapstructure:"file"`
+	// ReloadInterval is the period to check for changes in the file, 1m by
+	// default. A negative value disables reloading
+	ReloadInterval time.Duration         `mapstructure:"reload_interval"`
+	Attributes     []EnrichmentAttribute `mapstructure:"attributes"`
+}
+
+// CredentialsConfig defines the credentials of each tenant, identified by the
+// value of a metadata key once all the actions are applied
+type CredentialsConfig struct {
+	MetadataKey string `mapstructure:"metadata_key"`
+	// TargetKey is the metadata key to set, authorization by default
+	TargetKey string `mapstructure:"target_key"`
+	// File in YAML (or JSON) with a map of tenants to credentials
+	File string `mapstructure:"file"`
+	// ReloadInterval is the period to check for changes in the file, 1m by
+	// default. A negative value disables reloading
+	ReloadInterval time.Duration `mapstructure:"reload_interval"`
+	// Env maps tenants to the environment variables with their credentials,
+	// it takes precedence over the file
+	Env map[string]CredentialsEnv `mapstructure:"env"`
+}
+
+// CredentialsEnv are the names of the environment variables with the
+// credentials of a tenant, only one type of credentials must be defined
+type CredentialsEnv struct {
+	Authorization string `mapstructure:"authorization"`
+	BearerToken   string `mapstructure:"bearer_token"`
+	Username      string `mapstructure:"username"`
+	Password      string `mapstructure:"password"`
+}
+
+// JWTClaimConfig defines how to get a claim from a JWT in the metadata. The
+// signature is verified with the keys of a JWKS file or a static key, unless
+// InsecureSkipVerify is set.
+type JWTClaimConfig struct {
+	// MetadataKey with the token, authorization by default. The scheme (eg.
+	// Bearer) is removed
+	MetadataKey string `mapstructure:"metadata_key"`
+	Claim       string `mapstructure:"claim"`
+	// JWKSFile is a JSON Web Key Set file
+	JWKSFile string `mapstructure:"jwks_file"`
+	// KeyFile is a PEM public key or certificate, or a HMAC secret
+	KeyFile string `mapstructure:"key_file"`
+	// InsecureSkipVerify decodes the token without verifying the signature,
+	// only for trusted networks
+	InsecureSkipVerify bool `mapstructure:"insecure_skip_verify"`
+}
+
+// BodyConfig defines how to get a value from the body of a log record. The
+// JSON path is used with map bodies and JSON string bodies, the regex with
+// string bodies when the path does not give a value.
+type BodyConfig struct {
+	// JSONPath is a list of keys (or indexes of lists) separated by '.', with
+	// an optional '$.' prefix, eg. $.meta.tenant
+	JSONPath string `mapstructure:"json_path"`
+	// Regex returns the first capture group, or the whole match without groups
+	Regex string `mapstructure:"regex"`
+}
+
+// MetricNameMapping gives the value of the metrics whose name has the prefix
+// or matches the regex. The value can reference the capture groups of the
+// regex, eg. $1
+type MetricNameMapping struct {
+	Prefix string `mapstructure:"prefix"`
+	Regex  string `mapstructure:"regex"`
+	Value  string `mapstructure:"value"`
+}
+
+// EnrichmentAttribute is an attribute of the registry to set in the resource
+type EnrichmentAttribute struct {
+	Name   string     `mapstructure:"name"`
+	Action ActionType `mapstructure:"action"`
+}
+
+// RuleConfig defines a set of actions applied if all the match conditions are
+// true. A default rule has no conditions and it has to be the last one.
+type RuleConfig struct {
+	Name          string         `mapstructure:"name"`
+	Match         MatchConfig    `mapstructure:"match"`
+	Default       bool           `mapstructure:"default"`
 	ActionsConfig []ActionConfig `mapstructure:"actions"`
 }
 
+// MatchConfig are the conditions of a rule
+type MatchConfig struct {
+	// Attributes are resource attributes with the value to match
+	Attributes map[string]string `mapstructure:"attributes"`
+	// Exists are resource attributes which have to be present
+	Exists []string `mapstructure:"exists"`
+	// Metadata are context metadata keys with one of their values to match
+	Metadata map[string]string `mapstructure:"metadata"`
+}
+
+// UsageConfig defines the internal metrics to account the data forwarded per tenant
+type UsageConfig struct {
+	// MetadataKeys used as labels of the usage metrics, if empty the metrics are disabled
+	MetadataKeys []string `mapstructure:"metadata_keys"`
+	// MaxCardinality limits the number of different label sets, 0 means no limit
+	MaxCardinality int `mapstructure:"max_cardinality"`
+}
+
+// RateLimitMode defines what happens with the data over the limit
+type RateLimitMode string
+
+const (
+	// DROP discards the data and counts it
+	DROP RateLimitMode = "drop"
+	// REJECT returns a retryable error to the previous component
+	REJECT RateLimitMode = "reject"
+)
+
+// RateLimitConfig defines token bucket limits per tenant, identified by the
+// value of a metadata key once all the actions are applied
+type RateLimitConfig struct {
+	MetadataKey string                `mapstructure:"metadata_key"`
+	Mode        RateLimitMode         `mapstructure:"mode"`
+	Default     RateLimits            `mapstructure:"default"`
+	Overrides   map[string]RateLimits `mapstructure:"overrides"`
+	// MaxCardinality limits the number of tenants used as label of the
+	// metrics, 1000 by default
+	MaxCardinality int `mapstructure:"max_cardinality"`
+}
+
+// RateLimits are the limits for each signal, a missing limit means no limit
+// (or the default one in the overrides)
+type RateLimits struct {
+	Spans            RateLimit `mapstructure:"spans"`
+	LogRecords       RateLimit `mapstructure:"log_records"`
+	MetricDataPoints RateLimit `mapstructure:"metric_data_points"`
+}
+
+// RateLimit is a token bucket, rate is the number of items per second and
+// burst the size of the bucket (defaults to rate). A batch bigger than the
+// burst is never accepted.
+type RateLimit struct {
+	Rate  float64 `mapstructure:"rate"`
+	Burst float64 `mapstructure:"burst"`
+}
+
+// CardinalityLimitConfig caps the number of distinct values of a metadata key
+// seen during a sliding window. Once reached, new values are replaced by the
+// overflow value.
+type CardinalityLimitConfig struct {
+	Key       string `mapstructure:"key"`
+	MaxValues int    `mapstructure:"max_values"`
+	// Window is the period a value is remembered since it was last seen, 0 means forever
+	Window        time.Duration `mapstructure:"window"`
+	OverflowValue string        `mapstructure:"overflow_value"`
+}
+
 // ActionValue is the enum to capture the four types of actions to perform on the context
 type ActionType string
 
@@ -31,30 +344,436 @@ const (
 )
 
 type ActionConfig struct {
-	Key           *string    `mapstructure:"key"`
-	Action        ActionType `mapstructure:"action"`
-	ValueDefault  *string    `mapstructure:"value"`
-	FromAttribute *string    `mapstructure:"from_attribute"`
+	Key          *string    `mapstructure:"key"`
+	Action       ActionType `mapstructure:"action"`
+	ValueDefault *string    `mapstructure:"value"`
+	// FromAttribute is a resource attribute or an ordered list of them, the
+	// first one present is used
+	FromAttribute AttributeNames `mapstructure:"from_attribute"`
+	// FromJWTClaim reads the value from a claim of a JWT in the metadata, it
+	// takes precedence over FromAttribute
+	FromJWTClaim *JWTClaimConfig `mapstructure:"from_jwt_claim"`
+	// FromBody reads the value from the body of the log records, which are
+	// split by value. It takes precedence over FromAttribute
+	FromBody *BodyConfig `mapstructure:"from_body"`
+	// FromMetricName maps the names of the metrics to values, the metrics are
+	// split by value. It takes precedence over FromAttribute
+	FromMetricName []MetricNameMapping `mapstructure:"from_metric_name"`
+	// EmptyAsMissing treats empty, whitespace-only and null values of the
+	// sources as missing, overrides the global setting
+	EmptyAsMissing *bool `mapstructure:"empty_as_missing"`
+	// RemoveSource deletes the attribute from the resource once it is read
+	RemoveSource bool `mapstructure:"remove_source"`
+	// FanOut sends a copy of the resource for each value, taken from a list
+	// attribute, or the configured Values
+	FanOut bool     `mapstructure:"fan_out"`
+	Values []string `mapstructure:"values"`
+	// Sanitize the value according to the tenant ID rules of a backend
+	Sanitize     SanitizePreset `mapstructure:"sanitize"`
+	SanitizeMode SanitizeMode   `mapstructure:"sanitize_mode"`
+	// Validation of the final value before setting it in the context
+	Validation *ValidationConfig `mapstructure:"validation"`
+}
+
+// SanitizePreset is the backend whose tenant ID rules are applied
+type SanitizePreset string
+
+const (
+	SANITIZE_MIMIR  SanitizePreset = "mimir"
+	SANITIZE_LOKI   SanitizePreset = "loki"
+	SANITIZE_TEMPO  SanitizePreset = "tempo"
+	SANITIZE_CORTEX SanitizePreset = "cortex"
+)
+
+// SanitizeMode defines what happens with the values breaking the rules
+type SanitizeMode string
+
+const (
+	// SANITIZE_NORMALIZE replaces the unsupported characters and truncates the
+	// value (default). Values which cannot be normalized are rejected
+	SANITIZE_NORMALIZE SanitizeMode = "normalize"
+	// SANITIZE_REJECT returns a permanent error to the previous component
+	SANITIZE_REJECT SanitizeMode = "reject"
+)
+
+// AttributeNames is a list of resource attributes. A single string is also
+// accepted in the configuration, so `from_attribute: tenant` is the same as
+// `from_attribute: [tenant]`
+type AttributeNames []string
+
+// UnmarshalText implements encoding.TextUnmarshaler, used when the
+// configuration value is a single string
+func (a *AttributeNames) UnmarshalText(text []byte) error {
+	*a = AttributeNames{string(text)}
+	return nil
+}
+
+// InvalidPolicy defines what happens when a value does not pass the validation
+type InvalidPolicy string
+
+const (
+	// INVALID_FALLBACK replaces the value with the fallback one
+	INVALID_FALLBACK InvalidPolicy = "fallback"
+	// INVALID_DROP discards the data of the resource
+	INVALID_DROP InvalidPolicy = "drop"
+	// INVALID_REJECT returns a permanent error to the previous component
+	INVALID_REJECT InvalidPolicy = "reject"
+)
+
+// ValidationConfig defines the permitted values. A value is valid if it is not
+// in the deny list and, when any of allow, regex or file are defined, it
+// matches at least one of them.
+type ValidationConfig struct {
+	Allow []string `mapstructure:"allow"`
+	Deny  []string `mapstructure:"deny"`
+	Regex string   `mapstructure:"regex"`
+	// File with the permitted values, one per line. Empty lines and lines
+	// starting with '#' are ignored
+	File string `mapstructure:"file"`
+	// OnInvalid is fallback by default
+	OnInvalid InvalidPolicy `mapstructure:"on_invalid"`
+	Fallback  *string       `mapstructure:"fallback"`
 }
 
 // Validate checks if the extension configuration is valid
 func (cfg *Config) Validate() error {
-	if cfg.ActionsConfig == nil || len(cfg.ActionsConfig) == 0 {
+	if cfg.Preset != "" {
+		if err := cfg.validatePreset(); err != nil {
+			return err
+		}
+	} else if len(cfg.TenantFrom) > 0 || cfg.TenantDefault != nil {
+		return errMissingPreset
+	} else if len(cfg.ActionsConfig) == 0 && len(cfg.Rules) == 0 {
 		return errMissingActionConfig
 	}
 	for _, action := range cfg.ActionsConfig {
-		if action.Key == nil || *action.Key == "" {
-			return errMissingActionConfigKey
+		if err := action.Validate(); err != nil {
+			return err
+		}
+	}
+	if err := validateRules(cfg.Rules); err != nil {
+		return err
+	}
+	if cfg.MaxFanOut < 0 {
+		return errInvalidMaxFanOut
+	}
+	if cfg.Concurrency < 0 {
+		return errInvalidConcurrency
+	}
+	if cfg.MaxItems < 0 || cfg.MaxBytes < 0 {
+		return errInvalidChunkLimits
+	}
+	if cfg.Timeout < 0 {
+		return errInvalidTimeout
+	}
+	if cfg.Usage.MaxCardinality < 0 {
+		return errInvalidUsageCardinality
+	}
+	if cfg.RateLimit != nil {
+		if err := cfg.RateLimit.Validate(); err != nil {
+			return err
+		}
+	}
+	if cfg.Enrichment != nil {
+		if err := cfg.Enrichment.Validate(); err != nil {
+			return err
+		}
+	}
+	if cfg.Credentials != nil {
+		if err := cfg.Credentials.Validate(); err != nil {
+			return err
 		}
-		if action.Action != DELETE {
-			if action.FromAttribute == nil && action.ValueDefault == nil {
-				return errMissingActionConfigSource
+	}
+	names := make(map[string]struct{})
+	for name, aliases := range cfg.AttributeAliases {
+		for _, n := range append([]string{name}, aliases...) {
+			if _, exists := names[n]; exists || n == "" {
+				return errInvalidAttributeAliases
 			}
-		} else {
-			if action.FromAttribute != nil || action.ValueDefault != nil {
-				return errMissingActionDeleteParams
+			names[n] = struct{}{}
+		}
+	}
+	if cfg.MetadataLimits != nil {
+		if err := cfg.MetadataLimits.Validate(); err != nil {
+			return err
+		}
+	}
+	if cfg.TraceConsistency != nil {
+		if err := cfg.TraceConsistency.Validate(); err != nil {
+			return err
+		}
+	}
+	if cfg.Cache != nil {
+		if err := cfg.validateCache(); err != nil {
+			return err
+		}
+	}
+	for _, limit := range cfg.CardinalityLimits {
+		if limit.Key == "" {
+			return errMissingCardinalityKey
+		}
+		if limit.MaxValues <= 0 || limit.Window < 0 {
+			return errInvalidCardinalityLimit
+		}
+	}
+	return nil
+}
+
+// validMetadataKey checks if the key is a valid HTTP header name (RFC 9110
+// token) and gRPC metadata name, which only allows a subset of the characters.
+// Keys are case-insensitive, gRPC reserves the prefix grpc-
+func validMetadataKey(key string) bool {
+	if key == "" || strings.HasPrefix(strings.ToLower(key), "grpc-") {
+		return false
+	}
+	for _, c := range key {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		case c == '-', c == '_', c == '.':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// Validate checks if the action configuration is valid
+func (action *ActionConfig) Validate() error {
+	if action.Key == nil || *action.Key == "" {
+		return errMissingActionConfigKey
+	}
+	if !validMetadataKey(*action.Key) {
+		return fmt.Errorf("%w: %q", errInvalidMetadataKey, *action.Key)
+	}
+	if action.FanOut && action.Action != INSERT && action.Action != UPSERT {
+		return errInvalidFanOutAction
+	}
+	if len(action.Values) > 0 && !action.FanOut {
+		return errInvalidFanOutValues
+	}
+	if action.Action != DELETE {
+		if len(action.FromAttribute) == 0 && action.FromJWTClaim == nil && action.FromBody == nil &&
+			len(action.FromMetricName) == 0 && action.ValueDefault == nil && len(action.Values) == 0 {
+			return errMissingActionConfigSource
+		}
+		if len(action.FromAttribute) == 0 && action.RemoveSource {
+			return errMissingRemoveSourceAttr
+		}
+	} else {
+		if len(action.FromAttribute) > 0 || action.FromJWTClaim != nil || action.FromBody != nil ||
+			len(action.FromMetricName) > 0 || action.ValueDefault != nil || action.RemoveSource {
+			return errMissingActionDeleteParams
+		}
+		if action.Validation != nil {
+			return errInvalidDeleteValidation
+		}
+		if action.Sanitize != "" {
+			return errInvalidDeleteSanitize
+		}
+	}
+	switch action.Sanitize {
+	case "", SANITIZE_MIMIR, SANITIZE_LOKI, SANITIZE_TEMPO, SANITIZE_CORTEX:
+	default:
+		return errInvalidSanitizePreset
+	}
+	if action.SanitizeMode != "" && action.SanitizeMode != SANITIZE_NORMALIZE && action.SanitizeMode != SANITIZE_REJECT {
+		return errInvalidSanitizeMode
+	}
+	if action.Validation != nil {
+		if err := action.Validation.Validate(); err != nil {
+			return err
+		}
+	}
+	if action.FromJWTClaim != nil {
+		if err := action.FromJWTClaim.Validate(); err != nil {
+			return err
+		}
+	}
+	if action.FromBody != nil {
+		if err := action.FromBody.Validate(); err != nil {
+			return err
+		}
+	}
+	for _, mapping := range action.FromMetricName {
+		if err := mapping.Validate(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Validate checks if the rate limit configuration is valid
+func (cfg *RateLimitConfig) Validate() error {
+	if cfg.MetadataKey == "" {
+		return errMissingRateLimitKey
+	}
+	if cfg.Mode != "" && cfg.Mode != DROP && cfg.Mode != REJECT {
+		return errInvalidRateLimitMode
+	}
+	if cfg.MaxCardinality < 0 {
+		return errInvalidRateLimitCardinality
+	}
+	limits := []RateLimits{cfg.Default}
+	for _, l := range cfg.Overrides {
+		limits = append(limits, l)
+	}
+	for _, l := range limits {
+		for _, r := range []RateLimit{l.Spans, l.LogRecords, l.MetricDataPoints} {
+			if r.Rate < 0 || r.Burst < 0 {
+				return errInvalidRateLimit
 			}
 		}
 	}
 	return nil
 }
+
+// Validate checks if the validation configuration is valid
+func (cfg *ValidationConfig) Validate() error {
+	if len(cfg.Allow) == 0 && len(cfg.Deny) == 0 && cfg.Regex == "" && cfg.File == "" {
+		return errMissingValidationRules
+	}
+	if cfg.Regex != "" {
+		if _, err := regexp.Compile(cfg.Regex); err != nil {
+			return fmt.Errorf("invalid validation 'regex': %w", err)
+		}
+	}
+	switch cfg.OnInvalid {
+	case "", INVALID_FALLBACK:
+		if cfg.Fallback == nil {
+			return errMissingValidationFallback
+		}
+	case INVALID_DROP, INVALID_REJECT:
+	default:
+		return errInvalidValidationPolicy
+	}
+	return nil
+}
+
+// Validate checks if the enrichment configuration is valid
+func (cfg *EnrichmentConfig) Validate() error {
+	if cfg.MetadataKey == "" {
+		return errMissingEnrichmentKey
+	}
+	if cfg.File == "" {
+		return errMissingEnrichmentFile
+	}
+	if len(cfg.Attributes) == 0 {
+		return errMissingEnrichmentAttrs
+	}
+	for _, attr := range cfg.Attributes {
+		if attr.Name == "" {
+			return errInvalidEnrichmentAttr
+		}
+		switch attr.Action {
+		case INSERT, UPDATE, UPSERT:
+		default:
+			return errInvalidEnrichmentAttr
+		}
+	}
+	return nil
+}
+
+// Validate checks if the credentials configuration is valid
+func (cfg *CredentialsConfig) Validate() error {
+	if cfg.MetadataKey == "" {
+		return errMissingCredentialsKey
+	}
+	if cfg.File == "" && len(cfg.Env) == 0 {
+		return errMissingCredentialsSource
+	}
+	if cfg.TargetKey != "" && !validMetadataKey(cfg.TargetKey) {
+		return fmt.Errorf("%w: %q", errInvalidMetadataKey, cfg.TargetKey)
+	}
+	return nil
+}
+
+// Validate checks if the metadata limits configuration is valid
+func (cfg *MetadataLimitsConfig) Validate() error {
+	if cfg.MaxValueLength < 0 || cfg.MaxValues < 0 || cfg.MaxTotalBytes < 0 {
+		return errInvalidMetadataLimits
+	}
+	switch cfg.Policy {
+	case "", LIMIT_TRUNCATE, LIMIT_DROP, LIMIT_REJECT:
+	default:
+		return errInvalidLimitPolicy
+	}
+	return nil
+}
+
+// validateCache checks if the cache configuration is valid, the actions
+// removing attributes cannot be skipped
+func (cfg *Config) validateCache() error {
+	if cfg.Cache.MaxEntries < 0 || cfg.Cache.TTL < 0 {
+		return errInvalidCache
+	}
+	actions := cfg.actions()
+	for _, rule := range cfg.Rules {
+		actions = append(actions, rule.ActionsConfig...)
+	}
+	for _, action := range actions {
+		if action.RemoveSource {
+			return errInvalidCacheRemoveSource
+		}
+	}
+	return nil
+}
+
+// Validate checks if the trace consistency configuration is valid
+func (cfg *TraceConsistencyConfig) Validate() error {
+	if cfg.MetadataKey == "" {
+		return errMissingTraceKey
+	}
+	if cfg.Mode != "" && cfg.Mode != TRACE_ROOT && cfg.Mode != TRACE_FIRST_SEEN {
+		return errInvalidTraceMode
+	}
+	if cfg.MaxTraces < 0 || cfg.TTL < 0 || cfg.DecisionWait < 0 {
+		return errInvalidTraceLimits
+	}
+	if cfg.DecisionWait > 0 && cfg.Mode == TRACE_FIRST_SEEN {
+		return errInvalidDecisionWait
+	}
+	return nil
+}
+
+// Validate checks if the JWT claim configuration is valid
+func (cfg *JWTClaimConfig) Validate() error {
+	if cfg.Claim == "" {
+		return errMissingJWTClaim
+	}
+	sources := 0
+	for _, defined := range []bool{cfg.JWKSFile != "", cfg.KeyFile != "", cfg.InsecureSkipVerify} {
+		if defined {
+			sources++
+		}
+	}
+	if sources != 1 {
+		return errInvalidJWTVerification
+	}
+	return nil
+}
+
+// Validate checks if the body configuration is valid
+func (cfg *BodyConfig) Validate() error {
+	if cfg.JSONPath == "" && cfg.Regex == "" {
+		return errMissingBodySource
+	}
+	if cfg.Regex != "" {
+		if _, err := regexp.Compile(cfg.Regex); err != nil {
+			return fmt.Errorf("invalid from_body 'regex': %w", err)
+		}
+	}
+	return nil
+}
+
+// Validate checks if the metric name mapping is valid
+func (cfg *MetricNameMapping) Validate() error {
+	if cfg.Value == "" || (cfg.Prefix == "") == (cfg.Regex == "") {
+		return errInvalidMetricNameMapping
+	}
+	if cfg.Regex != "" {
+		if _, err := regexp.Compile(cfg.Regex); err != nil {
+			return fmt.Errorf("invalid from_metric_name 'regex': %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,58 @@
+package contextprocessor
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/collector/component"
+	"go.opentelemetry.io/collector/confmap/confmaptest"
+)
+
+func TestLoadConfigFromAttribute(t *testing.T) {
+	cm, err := confmaptest.LoadConf(filepath.Join("testdata", "config.yaml"))
+	require.NoError(t, err)
+
+	tests := []struct {
+		id       component.ID
+		expected AttributeNames
+	}{
+		{
+			id:       component.NewID(cfgType),
+			expected: AttributeNames{"tenant"},
+		},
+		{
+			id:       component.NewIDWithName(cfgType, "fallback"),
+			expected: AttributeNames{"tenant", "service.namespace", "k8s.namespace.name"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.id.String(), func(t *testing.T) {
+			cfg := createDefaultConfig().(*Config)
+			sub, err := cm.Sub(tt.id.String())
+			require.NoError(t, err)
+			require.NoError(t, sub.Unmarshal(cfg))
+			require.NoError(t, cfg.Validate())
+			require.Len(t, cfg.ActionsConfig, 1)
+			assert.Equal(t, tt.expected, cfg.ActionsConfig[0].FromAttribute)
+		})
+	}
+}
+
+func TestValidMetadataKey(t *testing.T) {
+	for _, key := range []string{"x-scope-orgid", "X-Scope-OrgID", "tenant", "x_team.name", "v1"} {
+		assert.True(t, validMetadataKey(key), key)
+	}
+	for _, key := range []string{"", "x scope", "x-scope-orgid:", "tenant\n", "tenänt", "x/team", "grpc-timeout", "GRPC-Status"} {
+		assert.False(t, validMetadataKey(key), key)
+	}
+
+	key := "X Scope"
+	value := "a"
+	err := (&ActionConfig{Key: &key, Action: UPSERT, ValueDefault: &value}).Validate()
+	assert.ErrorIs(t, err, errInvalidMetadataKey)
+	assert.ErrorContains(t, err, `"X Scope"`)
+	err = (&CredentialsConfig{MetadataKey: "x-scope-orgid", TargetKey: "grpc-authorization", Env: map[string]CredentialsEnv{"a": {BearerToken: "A"}}}).Validate()
+	assert.ErrorIs(t, err, errInvalidMetadataKey)
+}
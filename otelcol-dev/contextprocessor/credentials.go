@@ -0,0 +1,146 @@
+package contextprocessor
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"sync/atomic"
+
+	"go.uber.org/zap"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	defaultCredentialsKey = "authorization"
+)
+
+var (
+	// The parsing errors are not returned, they can contain part of the secrets
+	errInvalidCredentialsFile = errors.New("invalid credentials file format")
+	errInvalidCredentials     = errors.New("credentials must define only one of 'authorization', 'bearer_token' or 'username' and 'password'")
+)
+
+// tenantCredentials are the credentials of a tenant, only one type is defined
+type tenantCredentials struct {
+	Authorization string `yaml:"authorization"`
+	BearerToken   string `yaml:"bearer_token"`
+	Username      string `yaml:"username"`
+	Password      string `yaml:"password"`
+}
+
+// header returns the value of the authorization header
+func (c tenantCredentials) header() (string, error) {
+	defined := 0
+	for _, v := range []string{c.Authorization, c.BearerToken, c.Username + c.Password} {
+		if v != "" {
+			defined++
+		}
+	}
+	if defined != 1 {
+		return "", errInvalidCredentials
+	}
+	switch {
+	case c.Authorization != "":
+		return c.Authorization, nil
+	case c.BearerToken != "":
+		return "Bearer " + c.BearerToken, nil
+	default:
+		return "Basic " + base64.StdEncoding.EncodeToString([]byte(c.Username+":"+c.Password)), nil
+	}
+}
+
+// credentialsSetter is an Action which sets the authorization metadata of the
+// tenant. Secrets are never logged.
+type credentialsSetter struct {
+	key       string
+	targetKey string
+	// env has the headers from the environment variables, fixed at start
+	env map[string]string
+	// headers has the headers from the file
+	headers atomic.Pointer[map[string]string]
+	file    *reloadableFile
+}
+
+func newCredentialsSetter(logger *zap.Logger, cfg *CredentialsConfig) (*credentialsSetter, error) {
+	c := &credentialsSetter{
+		key:       cfg.MetadataKey,
+		targetKey: cfg.TargetKey,
+		env:       make(map[string]string, len(cfg.Env)),
+	}
+	if c.targetKey == "" {
+		c.targetKey = defaultCredentialsKey
+	}
+	for tenant, vars := range cfg.Env {
+		creds := tenantCredentials{}
+		for _, v := range []struct {
+			name  string
+			value *string
+		}{
+			{vars.Authorization, &creds.Authorization},
+			{vars.BearerToken, &creds.BearerToken},
+			{vars.Username, &creds.Username},
+			{vars.Password, &creds.Password},
+		} {
+			if v.name == "" {
+				continue
+			}
+			value, exists := os.LookupEnv(v.name)
+			if !exists {
+				return nil, fmt.Errorf("environment variable %q for the credentials of tenant %q is not defined", v.name, tenant)
+			}
+			*v.value = value
+		}
+		header, err := creds.header()
+		if err != nil {
+			return nil, fmt.Errorf("tenant %q: %w", tenant, err)
+		}
+		c.env[tenant] = header
+	}
+	empty := make(map[string]string)
+	c.headers.Store(&empty)
+	if cfg.File != "" {
+		file, err := newReloadableFile(logger, cfg.File, cfg.ReloadInterval, c.load)
+		if err != nil {
+			return nil, fmt.Errorf("cannot load credentials: %w", err)
+		}
+		c.file = file
+	}
+	return c, nil
+}
+
+// load parses the credentials file, YAML is a superset of JSON so both are accepted
+func (c *credentialsSetter) load(data []byte) error {
+	credentials := make(map[string]tenantCredentials)
+	if err := yaml.Unmarshal(data, &credentials); err != nil {
+		return errInvalidCredentialsFile
+	}
+	headers := make(map[string]string, len(credentials))
+	for tenant, creds := range credentials {
+		header, err := creds.header()
+		if err != nil {
+			return fmt.Errorf("tenant %q: %w", tenant, err)
+		}
+		headers[tenant] = header
+	}
+	c.headers.Store(&headers)
+	return nil
+}
+
+func (c *credentialsSetter) execute(eventContext *eventContext) {
+	values, exists := eventContext.getContextKey(c.key)
+	var header string
+	if exists {
+		// Only the first value of the key is the tenant
+		header, exists = c.env[values[0]]
+		if !exists {
+			header, exists = (*c.headers.Load())[values[0]]
+		}
+	}
+	if !exists {
+		// Other credentials are not forwarded for an unknown tenant
+		eventContext.delContextKey(c.targetKey)
+		return
+	}
+	eventContext.setContextKey(c.targetKey, []string{header})
+}
@@ -0,0 +1,127 @@
+package contextprocessor
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestTenantCredentialsHeader(t *testing.T) {
+	tests := []struct {
+		name        string
+		credentials tenantCredentials
+		expected    string
+	}{
+		{name: "authorization", credentials: tenantCredentials{Authorization: "Token abc"}, expected: "Token abc"},
+		{name: "bearer", credentials: tenantCredentials{BearerToken: "abc"}, expected: "Bearer abc"},
+		{name: "basic", credentials: tenantCredentials{Username: "user", Password: "pass"}, expected: "Basic dXNlcjpwYXNz"},
+		{name: "username only", credentials: tenantCredentials{Username: "user"}, expected: "Basic dXNlcjo="},
+		{name: "none", credentials: tenantCredentials{}},
+		{name: "several", credentials: tenantCredentials{BearerToken: "abc", Password: "pass"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header, err := tt.credentials.header()
+			if tt.expected == "" {
+				assert.ErrorIs(t, err, errInvalidCredentials)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, header)
+		})
+	}
+}
+
+// testCredentials returns the header set for the tenant, if any
+func testCredentials(c *credentialsSetter, tenant string) []string {
+	eventContext := newEventContext()
+	eventContext.setContextKey("x-scope-orgid", []string{tenant})
+	c.execute(eventContext)
+	values, _ := eventContext.getContextKey(c.targetKey)
+	return values
+}
+
+func TestCredentialsEnvPrecedence(t *testing.T) {
+	t.Setenv("TEAM_A_TOKEN", "from-env")
+	file := writeTestFile(t, "credentials.yaml", []byte("team-a:\n  bearer_token: from-file\nteam-b:\n  bearer_token: team-b-file\n"))
+	c, err := newCredentialsSetter(zap.NewNop(), &CredentialsConfig{
+		MetadataKey: "x-scope-orgid",
+		File:        file,
+		Env:         map[string]CredentialsEnv{"team-a": {BearerToken: "TEAM_A_TOKEN"}},
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"Bearer from-env"}, testCredentials(c, "team-a"))
+	assert.Equal(t, []string{"Bearer team-b-file"}, testCredentials(c, "team-b"))
+	assert.Nil(t, testCredentials(c, "team-c"))
+
+	_, err = newCredentialsSetter(zap.NewNop(), &CredentialsConfig{
+		MetadataKey: "x-scope-orgid",
+		Env:         map[string]CredentialsEnv{"team-a": {BearerToken: "UNDEFINED_TEAM_A_TOKEN"}},
+	})
+	assert.ErrorContains(t, err, "UNDEFINED_TEAM_A_TOKEN")
+}
+
+func TestCredentialsErrorsWithoutSecrets(t *testing.T) {
+	secret := "s3cr3t-value"
+	t.Setenv("TEAM_A_TOKEN", secret)
+	t.Setenv("TEAM_A_PASSWORD", secret)
+	for name, content := range map[string]string{
+		"invalid yaml":   "team-a:\n  bearer_token: " + secret + "\n  - [",
+		"invalid type":   "team-a: " + secret + "\n",
+		"several":        "team-a:\n  bearer_token: " + secret + "\n  password: " + secret + "\n",
+		"not a map":      "- " + secret + "\n",
+		"invalid fields": "team-a:\n  bearer_token: [" + secret + "]\n",
+	} {
+		_, err := newCredentialsSetter(zap.NewNop(), &CredentialsConfig{
+			MetadataKey: "x-scope-orgid",
+			File:        writeTestFile(t, "credentials.yaml", []byte(content)),
+		})
+		require.Error(t, err, name)
+		assert.NotContains(t, err.Error(), secret, name)
+	}
+	_, err := newCredentialsSetter(zap.NewNop(), &CredentialsConfig{
+		MetadataKey: "x-scope-orgid",
+		Env:         map[string]CredentialsEnv{"team-a": {BearerToken: "TEAM_A_TOKEN", Password: "TEAM_A_PASSWORD"}},
+	})
+	require.Error(t, err)
+	assert.NotContains(t, err.Error(), secret)
+}
+
+func TestCredentialsReloadInterval(t *testing.T) {
+	file := writeTestFile(t, "credentials.yaml", []byte("team-a:\n  bearer_token: abc\n"))
+	for interval, expected := range map[time.Duration]time.Duration{
+		0:           defaultReloadInterval,
+		time.Second: time.Second,
+		-1:          -1,
+	} {
+		cfg := &CredentialsConfig{MetadataKey: "x-scope-orgid", File: file, ReloadInterval: interval}
+		require.NoError(t, cfg.Validate())
+		c, err := newCredentialsSetter(zap.NewNop(), cfg)
+		require.NoError(t, err)
+		assert.Equal(t, expected, c.file.interval)
+	}
+}
+
+func TestCredentialsUnknownTenant(t *testing.T) {
+	t.Setenv("TEAM_A_TOKEN", "abc")
+	c, err := newCredentialsSetter(zap.NewNop(), &CredentialsConfig{
+		MetadataKey: "x-scope-orgid",
+		Env:         map[string]CredentialsEnv{"team-a": {BearerToken: "TEAM_A_TOKEN"}},
+	})
+	require.NoError(t, err)
+
+	for _, tenant := range []string{"team-b", ""} {
+		eventContext := newEventContext()
+		if tenant != "" {
+			eventContext.setContextKey("x-scope-orgid", []string{tenant})
+		}
+		eventContext.setContextKey("Authorization", []string{"Bearer stale"})
+		c.execute(eventContext)
+		_, exists := eventContext.newMetadata[defaultCredentialsKey]
+		assert.False(t, exists, tenant)
+	}
+}
@@ -0,0 +1,56 @@
+package contextprocessor
+
+import (
+	"errors"
+	"sync"
+)
+
+// dispatcher sends the payloads of a Consume call to the next consumer. With
+// more than one worker they are queued and sent concurrently once all the
+// resources are processed, otherwise each one is sent when it is ready.
+type dispatcher struct {
+	workers int
+	sends   []func() error
+}
+
+func (ctxt *contextProcessor) newDispatcher() *dispatcher {
+	return &dispatcher{workers: ctxt.concurrency}
+}
+
+// send sends the payload, or queues it with concurrency
+func (d *dispatcher) send(f func() error) error {
+	if d.workers <= 1 {
+		return f()
+	}
+	d.sends = append(d.sends, f)
+	return nil
+}
+
+// wait sends the queued payloads and returns their errors joined in the order
+// of the payloads, not of completion, followed by err, the error processing
+// the resources
+func (d *dispatcher) wait(err error) error {
+	if len(d.sends) == 0 {
+		return err
+	}
+	errs := make([]error, len(d.sends)+1)
+	next := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < d.workers && w < len(d.sends); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				errs[i] = d.sends[i]()
+			}
+		}()
+	}
+	for i := range d.sends {
+		next <- i
+	}
+	close(next)
+	wg.Wait()
+	d.sends = nil
+	errs[len(errs)-1] = err
+	return errors.Join(errs...)
+}
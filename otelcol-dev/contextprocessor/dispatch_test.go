@@ -0,0 +1,76 @@
+package contextprocessor
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/collector/client"
+	"go.opentelemetry.io/collector/consumer"
+	"go.opentelemetry.io/collector/pdata/plog"
+	"go.opentelemetry.io/collector/processor/processortest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestConcurrentDispatch(t *testing.T) {
+	key := "x-scope-orgid"
+	tenants := []string{"a", "b", "c", "d", "e", "f", "g", "h"}
+	cfg := &Config{
+		ActionsConfig: []ActionConfig{
+			{Key: &key, Action: UPSERT, FanOut: true, Values: tenants},
+		},
+		Concurrency: 3,
+	}
+	require.NoError(t, cfg.Validate())
+
+	var inFlight, maxInFlight atomic.Int32
+	var mutex sync.Mutex
+	received := make(map[string]int)
+	next, err := consumer.NewLogs(func(ctx context.Context, ld plog.Logs) error {
+		n := inFlight.Add(1)
+		defer inFlight.Add(-1)
+		for {
+			m := maxInFlight.Load()
+			if n <= m || maxInFlight.CompareAndSwap(m, n) {
+				break
+			}
+		}
+		tenant := client.FromContext(ctx).Metadata.Get(key)[0]
+		// The first failing payload completes last
+		if tenant == "c" {
+			time.Sleep(50 * time.Millisecond)
+		} else {
+			time.Sleep(10 * time.Millisecond)
+		}
+		mutex.Lock()
+		received[tenant] += ld.LogRecordCount()
+		mutex.Unlock()
+		if tenant == "c" || tenant == "f" {
+			return errors.New("cannot send " + tenant)
+		}
+		return nil
+	})
+	require.NoError(t, err)
+	p, err := NewContextLogsProcessor(processortest.NewNopSettings(), next, trace.WithAttributes(), cfg)
+	require.NoError(t, err)
+
+	ld := plog.NewLogs()
+	for i := 0; i < 3; i++ {
+		ld.ResourceLogs().AppendEmpty().ScopeLogs().AppendEmpty().LogRecords().AppendEmpty()
+	}
+	err = p.ConsumeLogs(context.Background(), ld)
+	require.Error(t, err)
+	// Errors are in the order of the payloads, not of completion
+	assert.Equal(t, strings.Repeat("cannot send c\ncannot send f\n", 3), err.Error()+"\n")
+	assert.LessOrEqual(t, maxInFlight.Load(), int32(3))
+	assert.Greater(t, maxInFlight.Load(), int32(1))
+	for _, tenant := range tenants {
+		assert.Equal(t, 3, received[tenant], tenant)
+	}
+}
@@ -0,0 +1,69 @@
+package contextprocessor
+
+import (
+	"fmt"
+	"sync/atomic"
+
+	"go.uber.org/zap"
+	"gopkg.in/yaml.v3"
+)
+
+// tenantRegistry maps each tenant to its attributes
+type tenantRegistry map[string]map[string]any
+
+// registryEnricher is an Action which sets resource attributes from the
+// registry entry of the tenant
+type registryEnricher struct {
+	key        string
+	attributes []EnrichmentAttribute
+	registry   atomic.Pointer[tenantRegistry]
+	file       *reloadableFile
+}
+
+func newRegistryEnricher(logger *zap.Logger, cfg *EnrichmentConfig) (*registryEnricher, error) {
+	e := &registryEnricher{
+		key:        cfg.MetadataKey,
+		attributes: cfg.Attributes,
+	}
+	file, err := newReloadableFile(logger, cfg.File, cfg.ReloadInterval, e.load)
+	if err != nil {
+		return nil, fmt.Errorf("cannot load enrichment registry: %w", err)
+	}
+	e.file = file
+	return e, nil
+}
+
+// load parses the registry, YAML is a superset of JSON so both are accepted
+func (e *registryEnricher) load(data []byte) error {
+	registry := make(tenantRegistry)
+	if err := yaml.Unmarshal(data, &registry); err != nil {
+		return err
+	}
+	e.registry.Store(&registry)
+	return nil
+}
+
+func (e *registryEnricher) execute(eventContext *eventContext) {
+	values, exists := eventContext.getContextKey(e.key)
+	if !exists {
+		return
+	}
+	// Only the first value of the key is the tenant
+	entry, exists := (*e.registry.Load())[values[0]]
+	if !exists {
+		return
+	}
+	for _, attr := range e.attributes {
+		value, exists := entry[attr.Name]
+		if !exists {
+			continue
+		}
+		_, present := eventContext.resourceAttrs.Get(attr.Name)
+		if (attr.Action == INSERT && present) || (attr.Action == UPDATE && !present) {
+			continue
+		}
+		if err := eventContext.resourceAttrs.PutEmpty(attr.Name).FromRaw(value); err != nil {
+			eventContext.resourceAttrs.PutStr(attr.Name, fmt.Sprint(value))
+		}
+	}
+}
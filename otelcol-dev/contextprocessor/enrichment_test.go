@@ -0,0 +1,100 @@
+package contextprocessor
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/collector/client"
+	"go.opentelemetry.io/collector/consumer/consumertest"
+	"go.opentelemetry.io/collector/pdata/plog"
+	"go.opentelemetry.io/collector/processor/processortest"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+)
+
+func TestEnrichmentFanOut(t *testing.T) {
+	registry := filepath.Join(t.TempDir(), "tenants.yaml")
+	require.NoError(t, os.WriteFile(registry, []byte("a:\n  cost_center: A\nb:\n  cost_center: B\n"), 0o600))
+	key := "x-scope-orgid"
+	cfg := &Config{
+		ActionsConfig: []ActionConfig{
+			{Key: &key, Action: UPSERT, FanOut: true, Values: []string{"a", "b"}},
+		},
+		Enrichment: &EnrichmentConfig{
+			MetadataKey: key,
+			File:        registry,
+			Attributes:  []EnrichmentAttribute{{Name: "cost_center", Action: UPSERT}},
+		},
+	}
+	require.NoError(t, cfg.Validate())
+	sink := &consumertest.LogsSink{}
+	p, err := NewContextLogsProcessor(processortest.NewNopSettings(), sink, trace.WithAttributes(), cfg)
+	require.NoError(t, err)
+
+	ld := plog.NewLogs()
+	ld.ResourceLogs().AppendEmpty().Resource().Attributes().PutStr("service.name", "ingress")
+	require.NoError(t, p.ConsumeLogs(context.Background(), ld))
+
+	// The incoming resource is not changed
+	_, exists := ld.ResourceLogs().At(0).Resource().Attributes().Get("cost_center")
+	assert.False(t, exists)
+	require.Len(t, sink.AllLogs(), 2)
+	for i, expected := range []string{"A", "B"} {
+		attrs := sink.AllLogs()[i].ResourceLogs().At(0).Resource().Attributes()
+		value, exists := attrs.Get("cost_center")
+		require.True(t, exists)
+		assert.Equal(t, expected, value.Str())
+		assert.Equal(t, "ingress", attrs.AsRaw()["service.name"])
+	}
+}
+
+func TestEnrichmentCopiesPerTenant(t *testing.T) {
+	registry := filepath.Join(t.TempDir(), "tenants.yaml")
+	require.NoError(t, os.WriteFile(registry, []byte("a:\n  cost_center: A\n"), 0o600))
+	enricher, err := newRegistryEnricher(zap.NewNop(), &EnrichmentConfig{
+		MetadataKey: "x-scope-orgid",
+		File:        registry,
+		Attributes:  []EnrichmentAttribute{{Name: "cost_center", Action: INSERT}},
+	})
+	require.NoError(t, err)
+	ar := NewActionsRunner()
+	key := "x-scope-orgid"
+	require.NoError(t, ar.AddAction(ActionConfig{Key: &key, Action: UPSERT, FanOut: true, FromAttribute: AttributeNames{"tenants"}}))
+	ar.addResourceCopyAction(enricher)
+
+	attrs := newTestAttributes(map[string]any{"tenants": []any{"a", "b"}})
+	copies, err := ar.applyWithValues(context.Background(), attrs, sourceValues{})
+	require.NoError(t, err)
+	require.Len(t, copies, 2)
+	assert.Equal(t, []string{"a"}, client.FromContext(copies[0].getContext()).Metadata.Get(key))
+	assert.Equal(t, "A", copies[0].resourceAttrs.AsRaw()["cost_center"])
+	assert.NotContains(t, copies[1].resourceAttrs.AsRaw(), "cost_center")
+	assert.NotContains(t, attrs.AsRaw(), "cost_center")
+}
+
+func TestEnrichmentReloadInterval(t *testing.T) {
+	registry := filepath.Join(t.TempDir(), "tenants.yaml")
+	require.NoError(t, os.WriteFile(registry, []byte("a:\n  cost_center: A\n"), 0o600))
+	// The same convention as the credentials file
+	for interval, expected := range map[time.Duration]time.Duration{
+		0:           defaultReloadInterval,
+		time.Second: time.Second,
+		-1:          -1,
+	} {
+		cfg := &EnrichmentConfig{
+			MetadataKey:    "x-scope-orgid",
+			File:           registry,
+			ReloadInterval: interval,
+			Attributes:     []EnrichmentAttribute{{Name: "cost_center", Action: UPSERT}},
+		}
+		require.NoError(t, cfg.Validate())
+		enricher, err := newRegistryEnricher(zap.NewNop(), cfg)
+		require.NoError(t, err)
+		assert.Equal(t, expected, enricher.file.interval)
+	}
+}
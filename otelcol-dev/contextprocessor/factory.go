@@ -21,7 +21,12 @@ var (
 
 // Note: This isn't a valid configuration because the processor would do no work.
 func createDefaultConfig() component.Config {
-	return &Config{}
+	return &Config{
+		MaxFanOut: 10,
+		Usage: UsageConfig{
+			MaxCardinality: 1000,
+		},
+	}
 }
 
 // NewFactory returns a new factory for the Resource processor.
@@ -46,9 +51,8 @@ func createMetricsProcessor(
 	cfg component.Config,
 	nextConsumer consumer.Metrics) (processor.Metrics, error) {
 
-	ctxtpActions := cfg.(*Config).ActionsConfig
 	tracing := trace.WithAttributes(attribute.String("processor", set.ID.String()))
-	ctxtp, err := NewContextMetricsProcessor(set.Logger, nextConsumer, tracing, ctxtpActions)
+	ctxtp, err := NewContextMetricsProcessor(set, nextConsumer, tracing, cfg.(*Config))
 	if err != nil {
 		return nil, err
 	}
@@ -76,9 +80,8 @@ func createLogsProcessor(
 	cfg component.Config,
 	nextConsumer consumer.Logs) (processor.Logs, error) {
 
-	ctxtpActions := cfg.(*Config).ActionsConfig
 	tracing := trace.WithAttributes(attribute.String("processor", set.ID.String()))
-	ctxtp, err := NewContextLogsProcessor(set.Logger, nextConsumer, tracing, ctxtpActions)
+	ctxtp, err := NewContextLogsProcessor(set, nextConsumer, tracing, cfg.(*Config))
 	if err != nil {
 		return nil, err
 	}
@@ -106,9 +109,8 @@ func createTracesProcessor(
 	cfg component.Config,
 	nextConsumer consumer.Traces) (processor.Traces, error) {
 
-	ctxtpActions := cfg.(*Config).ActionsConfig
 	tracing := trace.WithAttributes(attribute.String("processor", set.ID.String()))
-	ctxtp, err := NewContextTracesProcessor(set.Logger, nextConsumer, tracing, ctxtpActions)
+	ctxtp, err := NewContextTracesProcessor(set, nextConsumer, tracing, cfg.(*Config))
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,66 @@
+package contextprocessor
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.uber.org/zap"
+)
+
+// fanOutLimiter limits and counts the copies of the resources generated by the
+// fan out actions
+type fanOutLimiter struct {
+	logger    *zap.Logger
+	maxFanOut int
+	attrs     metric.MeasurementOption
+	copies    metric.Int64Counter
+	truncated metric.Int64Counter
+}
+
+func newFanOutLimiter(
+	logger *zap.Logger,
+	meter metric.Meter,
+	processor attribute.KeyValue,
+	signal string,
+	maxFanOut int) (*fanOutLimiter, error) {
+
+	copies, err := meter.Int64Counter(
+		"processor_context_fan_out_copies",
+		metric.WithDescription("Number of additional copies of resources sent by the fan out actions"),
+		metric.WithUnit("{copies}"),
+	)
+	if err != nil {
+		return nil, err
+	}
+	truncated, err := meter.Int64Counter(
+		"processor_context_fan_out_truncated",
+		metric.WithDescription("Number of copies of resources not sent because of the max fan out"),
+		metric.WithUnit("{copies}"),
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &fanOutLimiter{
+		logger:    logger,
+		maxFanOut: maxFanOut,
+		attrs:     metric.WithAttributes(processor, attribute.String("signal", signal)),
+		copies:    copies,
+		truncated: truncated,
+	}, nil
+}
+
+// limit returns the number of copies to send, at most maxFanOut
+func (f *fanOutLimiter) limit(ctx context.Context, copies int) int {
+	if copies <= 1 {
+		return copies
+	}
+	if f.maxFanOut > 0 && copies > f.maxFanOut {
+		f.logger.Debug("Fan out limit reached, copies discarded",
+			zap.Int("max_fan_out", f.maxFanOut), zap.Int("copies", copies))
+		f.truncated.Add(ctx, int64(copies-f.maxFanOut), f.attrs)
+		copies = f.maxFanOut
+	}
+	f.copies.Add(ctx, int64(copies-1), f.attrs)
+	return copies
+}
@@ -0,0 +1,77 @@
+package contextprocessor
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/collector/client"
+	"go.opentelemetry.io/collector/pdata/plog"
+	"go.opentelemetry.io/collector/processor/processortest"
+	"go.opentelemetry.io/otel/attribute"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestFanOutLimit(t *testing.T) {
+	meter, reader := newTestMetricReader()
+	f, err := newFanOutLimiter(processortest.NewNopSettings().Logger, meter, newTestProcessorID(), "spans", 3)
+	require.NoError(t, err)
+
+	// A single copy is not a fan out
+	assert.Equal(t, 1, f.limit(context.Background(), 1))
+	assert.Nil(t, collectSum(t, reader, "processor_context_fan_out_copies"))
+	assert.Equal(t, 2, f.limit(context.Background(), 2))
+	assert.Equal(t, 3, f.limit(context.Background(), 5))
+	assert.Equal(t, int64(1+2), collectSum(t, reader, "processor_context_fan_out_copies")[0].Value)
+	assert.Equal(t, int64(2), collectSum(t, reader, "processor_context_fan_out_truncated")[0].Value)
+
+	// 0 means no limit
+	f.maxFanOut = 0
+	assert.Equal(t, 20, f.limit(context.Background(), 20))
+	assert.Equal(t, int64(2), collectSum(t, reader, "processor_context_fan_out_truncated")[0].Value)
+}
+
+func TestLogsMaxFanOut(t *testing.T) {
+	key := "x-scope-orgid"
+	tenants := make([]string, 0, 12)
+	for i := 0; i < cap(tenants); i++ {
+		tenants = append(tenants, fmt.Sprintf("team-%d", i))
+	}
+	cfg := createDefaultConfig().(*Config)
+	cfg.ActionsConfig = []ActionConfig{{Key: &key, Action: UPSERT, FanOut: true, FromAttribute: AttributeNames{"tenants"}}}
+	require.NoError(t, cfg.Validate())
+	require.Equal(t, 10, cfg.MaxFanOut)
+
+	reader := sdkmetric.NewManualReader()
+	set := processortest.NewNopSettings()
+	set.MeterProvider = sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))
+	sink := &testLogsSink{}
+	p, err := NewContextLogsProcessor(set, sink, trace.WithAttributes(), cfg)
+	require.NoError(t, err)
+
+	ld := plog.NewLogs()
+	rl := ld.ResourceLogs().AppendEmpty()
+	values := rl.Resource().Attributes().PutEmptySlice("tenants")
+	for _, tenant := range tenants {
+		values.AppendEmpty().SetStr(tenant)
+	}
+	rl.ScopeLogs().AppendEmpty().LogRecords().AppendEmpty().Body().SetStr("shared")
+	require.NoError(t, p.ConsumeLogs(context.Background(), ld))
+
+	// The first copies are sent, up to max_fan_out
+	require.Len(t, sink.logs, 10)
+	for i, ctx := range sink.contexts {
+		assert.Equal(t, []string{tenants[i]}, client.FromContext(ctx).Metadata.Get(key))
+	}
+	copies := collectSum(t, reader, "processor_context_fan_out_copies")
+	require.Len(t, copies, 1)
+	assert.Equal(t, int64(9), copies[0].Value)
+	signal, _ := copies[0].Attributes.Value(attribute.Key("signal"))
+	assert.Equal(t, "log_records", signal.AsString())
+	truncated := collectSum(t, reader, "processor_context_fan_out_truncated")
+	require.Len(t, truncated, 1)
+	assert.Equal(t, int64(2), truncated[0].Value)
+}
@@ -0,0 +1,190 @@
+package contextprocessor
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-jose/go-jose/v4"
+	"github.com/go-jose/go-jose/v4/jwt"
+)
+
+const (
+	defaultJWTKey = "authorization"
+)
+
+var (
+	errInvalidJWKSFile = errors.New("invalid JWKS file format")
+	errInvalidKeyFile  = errors.New("invalid PEM key file")
+	errUnknownJWTKey   = errors.New("no key matches the token")
+
+	jwtAlgorithms = []jose.SignatureAlgorithm{
+		jose.RS256, jose.RS384, jose.RS512,
+		jose.PS256, jose.PS384, jose.PS512,
+		jose.ES256, jose.ES384, jose.ES512,
+		jose.EdDSA,
+		jose.HS256, jose.HS384, jose.HS512,
+	}
+)
+
+// jwtClaim gets the values of a claim from a JWT in the metadata. Tokens which
+// cannot be decoded, verified or are expired are ignored.
+type jwtClaim struct {
+	key      string
+	claim    string
+	keys     []jose.JSONWebKey
+	insecure bool
+}
+
+func newJWTClaim(cfg *JWTClaimConfig) (*jwtClaim, error) {
+	j := &jwtClaim{
+		key:      cfg.MetadataKey,
+		claim:    cfg.Claim,
+		insecure: cfg.InsecureSkipVerify,
+	}
+	if j.key == "" {
+		j.key = defaultJWTKey
+	}
+	switch {
+	case cfg.JWKSFile != "":
+		data, err := os.ReadFile(cfg.JWKSFile)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read JWKS file: %w", err)
+		}
+		jwks := jose.JSONWebKeySet{}
+		if err = json.Unmarshal(data, &jwks); err != nil || len(jwks.Keys) == 0 {
+			return nil, errInvalidJWKSFile
+		}
+		j.keys = jwks.Keys
+	case cfg.KeyFile != "":
+		data, err := os.ReadFile(cfg.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read key file: %w", err)
+		}
+		key, err := parseKey(data)
+		if err != nil {
+			return nil, err
+		}
+		j.keys = []jose.JSONWebKey{{Key: key}}
+	}
+	return j, nil
+}
+
+// parseKey returns the public key of a PEM file, or the content as HMAC secret
+// if it is not PEM. The parsing errors are not returned, they can contain
+// part of the secret.
+func parseKey(data []byte) (any, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		secret := bytes.TrimSpace(data)
+		if len(secret) == 0 {
+			return nil, errInvalidKeyFile
+		}
+		return secret, nil
+	}
+	switch block.Type {
+	case "CERTIFICATE":
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, errInvalidKeyFile
+		}
+		return cert.PublicKey, nil
+	default:
+		key, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, errInvalidKeyFile
+		}
+		return key, nil
+	}
+}
+
+// values returns the values of the claim, a list claim has several values
+func (j *jwtClaim) values(eventContext *eventContext) ([]string, bool) {
+	header, exists := eventContext.getContextKey(j.key)
+	if !exists {
+		return nil, false
+	}
+	claims, expiry, err := j.claims(header[0])
+	if err != nil {
+		return nil, false
+	}
+	eventContext.expireAt(expiry)
+	return claimValues(claims[j.claim])
+}
+
+// claims decodes the token, removing the scheme, and checks the signature and
+// the time claims. The expiry is zero if the token has no exp claim.
+func (j *jwtClaim) claims(header string) (map[string]any, time.Time, error) {
+	token := strings.TrimSpace(header)
+	if i := strings.IndexByte(token, ' '); i >= 0 {
+		token = strings.TrimSpace(token[i+1:])
+	}
+	parsed, err := jwt.ParseSigned(token, jwtAlgorithms)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	registered := jwt.Claims{}
+	claims := make(map[string]any)
+	if j.insecure {
+		err = parsed.UnsafeClaimsWithoutVerification(&registered, &claims)
+	} else {
+		err = j.verify(parsed, &registered, &claims)
+	}
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	if err = registered.ValidateWithLeeway(jwt.Expected{Time: time.Now()}, jwt.DefaultLeeway); err != nil {
+		return nil, time.Time{}, err
+	}
+	if registered.Expiry == nil {
+		return claims, time.Time{}, nil
+	}
+	return claims, registered.Expiry.Time(), nil
+}
+
+// verify tries the keys with the key ID of the token, or all of them if the
+// token has no key ID
+func (j *jwtClaim) verify(token *jwt.JSONWebToken, dest ...any) error {
+	kid := ""
+	if len(token.Headers) > 0 {
+		kid = token.Headers[0].KeyID
+	}
+	for _, key := range j.keys {
+		if kid != "" && key.KeyID != "" && key.KeyID != kid {
+			continue
+		}
+		if err := token.Claims(key.Key, dest...); err == nil {
+			return nil
+		}
+	}
+	return errUnknownJWTKey
+}
+
+// claimValues converts a claim to strings, a list claim has several values
+func claimValues(claim any) ([]string, bool) {
+	switch v := claim.(type) {
+	case string:
+		return []string{v}, true
+	case float64:
+		return []string{strconv.FormatFloat(v, 'f', -1, 64)}, true
+	case bool:
+		return []string{strconv.FormatBool(v)}, true
+	case []any:
+		values := make([]string, 0, len(v))
+		for _, item := range v {
+			if itemValues, ok := claimValues(item); ok && len(itemValues) == 1 {
+				values = append(values, itemValues[0])
+			}
+		}
+		return values, len(values) > 0
+	default:
+		return nil, false
+	}
+}
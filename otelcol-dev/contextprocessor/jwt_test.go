@@ -0,0 +1,232 @@
+package contextprocessor
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-jose/go-jose/v4"
+	"github.com/go-jose/go-jose/v4/jwt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/collector/client"
+)
+
+// newTestJWTContext returns a context with the token in the authorization key
+func newTestJWTContext(token string) context.Context {
+	return client.NewContext(context.Background(), client.Info{
+		Metadata: client.NewMetadata(map[string][]string{"authorization": {"Bearer " + token}}),
+	})
+}
+
+var testJWTSecret = []byte("0123456789abcdef0123456789abcdef")
+
+// newTestSigner signs the tokens with the HMAC test secret
+func newTestSigner(t *testing.T) jose.Signer {
+	signer, err := jose.NewSigner(jose.SigningKey{Algorithm: jose.HS256, Key: testJWTSecret}, nil)
+	require.NoError(t, err)
+	return signer
+}
+
+func TestJWTClaimEmptyFallback(t *testing.T) {
+	key := "x-scope-orgid"
+	anonymous := "anonymous"
+	emptyAsMissing := true
+	ar := NewActionsRunner()
+	require.NoError(t, ar.AddAction(ActionConfig{
+		Key:            &key,
+		Action:         UPSERT,
+		ValueDefault:   &anonymous,
+		FromAttribute:  AttributeNames{"tenant"},
+		FromJWTClaim:   &JWTClaimConfig{Claim: "tenant", InsecureSkipVerify: true},
+		EmptyAsMissing: &emptyAsMissing,
+	}))
+	token, err := jwt.Signed(newTestSigner(t)).Claims(map[string]any{"tenant": ""}).Serialize()
+	require.NoError(t, err)
+
+	ctxs, err := ar.Apply(newTestJWTContext(token), newTestAttributes(map[string]any{"tenant": "team-a"}))
+	require.NoError(t, err)
+	require.Len(t, ctxs, 1)
+	assert.Equal(t, []string{"team-a"}, client.FromContext(ctxs[0]).Metadata.Get(key))
+
+	ctxs, err = ar.Apply(newTestJWTContext(token), newTestAttributes(nil))
+	require.NoError(t, err)
+	require.Len(t, ctxs, 1)
+	assert.Equal(t, []string{anonymous}, client.FromContext(ctxs[0]).Metadata.Get(key))
+}
+
+// writeTestFile writes the data in a file of the test directory
+func writeTestFile(t *testing.T, name string, data []byte) string {
+	path := filepath.Join(t.TempDir(), name)
+	require.NoError(t, os.WriteFile(path, data, 0o600))
+	return path
+}
+
+// writeTestPublicKey writes the public key in a PEM file
+func writeTestPublicKey(t *testing.T, key any) string {
+	der, err := x509.MarshalPKIXPublicKey(key)
+	require.NoError(t, err)
+	return writeTestFile(t, "key.pem", pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}))
+}
+
+// signTestToken returns a token with the tenant claim, signed with the key
+func signTestToken(t *testing.T, alg jose.SignatureAlgorithm, key any, kid string, claims map[string]any) string {
+	opts := &jose.SignerOptions{}
+	if kid != "" {
+		opts = opts.WithHeader(jose.HeaderKey("kid"), kid)
+	}
+	signer, err := jose.NewSigner(jose.SigningKey{Algorithm: alg, Key: key}, opts)
+	require.NoError(t, err)
+	token, err := jwt.Signed(signer).Claims(claims).Serialize()
+	require.NoError(t, err)
+	return token
+}
+
+// testClaim returns the values of the tenant claim of the token
+func testClaim(t *testing.T, cfg *JWTClaimConfig, token string) ([]string, bool) {
+	cfg.Claim = "tenant"
+	require.NoError(t, cfg.Validate())
+	claim, err := newJWTClaim(cfg)
+	require.NoError(t, err)
+	eventContext := newEventContext()
+	eventContext.setContextKey("authorization", []string{"Bearer " + token})
+	return claim.values(eventContext)
+}
+
+func TestJWTClaimVerify(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	otherKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	claims := map[string]any{"tenant": "team-a", "exp": time.Now().Add(time.Hour).Unix()}
+
+	tests := []struct {
+		name     string
+		cfg      *JWTClaimConfig
+		token    string
+		expected []string
+	}{
+		{
+			name:     "rsa",
+			cfg:      &JWTClaimConfig{KeyFile: writeTestPublicKey(t, &rsaKey.PublicKey)},
+			token:    signTestToken(t, jose.RS256, rsaKey, "", claims),
+			expected: []string{"team-a"},
+		},
+		{
+			name:     "ecdsa",
+			cfg:      &JWTClaimConfig{KeyFile: writeTestPublicKey(t, &ecKey.PublicKey)},
+			token:    signTestToken(t, jose.ES256, ecKey, "", claims),
+			expected: []string{"team-a"},
+		},
+		{
+			name:     "hmac",
+			cfg:      &JWTClaimConfig{KeyFile: writeTestFile(t, "secret", testJWTSecret)},
+			token:    signTestToken(t, jose.HS256, testJWTSecret, "", claims),
+			expected: []string{"team-a"},
+		},
+		{
+			name:  "wrong key",
+			cfg:   &JWTClaimConfig{KeyFile: writeTestPublicKey(t, &otherKey.PublicKey)},
+			token: signTestToken(t, jose.ES256, ecKey, "", claims),
+		},
+		{
+			name:  "hmac with public key",
+			cfg:   &JWTClaimConfig{KeyFile: writeTestPublicKey(t, &rsaKey.PublicKey)},
+			token: signTestToken(t, jose.HS256, testJWTSecret, "", claims),
+		},
+		{
+			name: "expired",
+			cfg:  &JWTClaimConfig{KeyFile: writeTestFile(t, "secret", testJWTSecret)},
+			token: signTestToken(t, jose.HS256, testJWTSecret, "", map[string]any{
+				"tenant": "team-a",
+				"exp":    time.Now().Add(-time.Hour).Unix(),
+			}),
+		},
+		{
+			name: "not yet valid",
+			cfg:  &JWTClaimConfig{InsecureSkipVerify: true},
+			token: signTestToken(t, jose.HS256, testJWTSecret, "", map[string]any{
+				"tenant": "team-a",
+				"nbf":    time.Now().Add(time.Hour).Unix(),
+			}),
+		},
+		{
+			name:     "insecure skip verify",
+			cfg:      &JWTClaimConfig{InsecureSkipVerify: true},
+			token:    signTestToken(t, jose.ES256, otherKey, "", claims),
+			expected: []string{"team-a"},
+		},
+		{
+			name:  "malformed",
+			cfg:   &JWTClaimConfig{InsecureSkipVerify: true},
+			token: "not-a-token",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			values, ok := testClaim(t, tt.cfg, tt.token)
+			assert.Equal(t, tt.expected != nil, ok)
+			assert.Equal(t, tt.expected, values)
+		})
+	}
+}
+
+func TestJWTClaimAlgNone(t *testing.T) {
+	encode := base64.RawURLEncoding.EncodeToString
+	token := encode([]byte(`{"alg":"none","typ":"JWT"}`)) + "." + encode([]byte(`{"tenant":"team-a"}`)) + "."
+	for _, cfg := range []*JWTClaimConfig{
+		{KeyFile: writeTestFile(t, "secret", testJWTSecret)},
+		{InsecureSkipVerify: true},
+	} {
+		values, ok := testClaim(t, cfg, token)
+		assert.False(t, ok)
+		assert.Nil(t, values)
+	}
+}
+
+func TestJWTClaimKeyID(t *testing.T) {
+	first, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	second, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	jwks, err := json.Marshal(jose.JSONWebKeySet{Keys: []jose.JSONWebKey{
+		{Key: &first.PublicKey, KeyID: "first", Algorithm: string(jose.ES256)},
+		{Key: &second.PublicKey, KeyID: "second", Algorithm: string(jose.ES256)},
+	}})
+	require.NoError(t, err)
+	cfg := &JWTClaimConfig{JWKSFile: writeTestFile(t, "jwks.json", jwks)}
+	claims := map[string]any{"tenant": "team-a"}
+
+	values, ok := testClaim(t, cfg, signTestToken(t, jose.ES256, second, "second", claims))
+	assert.True(t, ok)
+	assert.Equal(t, []string{"team-a"}, values)
+	// Without key ID all the keys are tried
+	values, ok = testClaim(t, cfg, signTestToken(t, jose.ES256, second, "", claims))
+	assert.True(t, ok)
+	assert.Equal(t, []string{"team-a"}, values)
+	// The key of the key ID does not verify it
+	_, ok = testClaim(t, cfg, signTestToken(t, jose.ES256, second, "first", claims))
+	assert.False(t, ok)
+	_, ok = testClaim(t, cfg, signTestToken(t, jose.ES256, second, "unknown", claims))
+	assert.False(t, ok)
+}
+
+func TestJWTClaimValues(t *testing.T) {
+	cfg := &JWTClaimConfig{InsecureSkipVerify: true}
+	token := signTestToken(t, jose.HS256, testJWTSecret, "", map[string]any{"tenant": []any{"team-a", 1, true, map[string]any{}}})
+	values, ok := testClaim(t, cfg, token)
+	assert.True(t, ok)
+	assert.Equal(t, []string{"team-a", "1", "true"}, values)
+}
@@ -0,0 +1,175 @@
+package contextprocessor
+
+import (
+	"fmt"
+	"strings"
+
+	"go.opentelemetry.io/collector/consumer/consumererror"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+const (
+	limitValueLength = "value_length"
+	limitValues      = "values"
+	limitTotalBytes  = "total_bytes"
+)
+
+// metadataLimiter enforces the size limits of the metadata when the keys are
+// set, so the exporters do not fail with too big headers
+type metadataLimiter struct {
+	maxValueLength int
+	maxValues      int
+	maxTotalBytes  int
+	policy         LimitPolicy
+	// secrets are the keys with credentials, they are never limited
+	secrets   map[string]struct{}
+	processor attribute.KeyValue
+	limited   metric.Int64Counter
+}
+
+func newMetadataLimiter(
+	meter metric.Meter,
+	processor attribute.KeyValue,
+	cfg *MetadataLimitsConfig) (*metadataLimiter, error) {
+
+	limited, err := meter.Int64Counter(
+		"processor_context_metadata_limited",
+		metric.WithDescription("Number of metadata keys over a size limit, by limit and policy"),
+		metric.WithUnit("{keys}"),
+	)
+	if err != nil {
+		return nil, err
+	}
+	policy := cfg.Policy
+	if policy == "" {
+		policy = LIMIT_TRUNCATE
+	}
+	return &metadataLimiter{
+		maxValueLength: cfg.MaxValueLength,
+		maxValues:      cfg.MaxValues,
+		maxTotalBytes:  cfg.MaxTotalBytes,
+		policy:         policy,
+		secrets:        make(map[string]struct{}),
+		processor:      processor,
+		limited:        limited,
+	}, nil
+}
+
+// exempt excludes a key with credentials from the limits, a truncated or
+// missing secret sends invalid credentials. Its size still counts in the
+// total of the other keys.
+func (l *metadataLimiter) exempt(key string) {
+	l.secrets[canonicalKey(key)] = struct{}{}
+}
+
+// apply returns the values of the key within the limits, or false if the key
+// cannot be set. With the policies drop and reject the error of the context
+// is set. The values of the fan out keys are not limited in number, each copy
+// of the resource only has one of them.
+func (l *metadataLimiter) apply(eventContext *eventContext, key string, values []string, fanOut bool) ([]string, bool) {
+	if _, exists := l.secrets[key]; exists {
+		return values, true
+	}
+	if l.maxValueLength > 0 && maxLength(values) > l.maxValueLength {
+		if !l.exceeded(eventContext, key, limitValueLength) {
+			return nil, false
+		}
+		// The values can be shared with the incoming metadata
+		truncated := make([]string, 0, len(values))
+		for _, value := range values {
+			if len(value) > l.maxValueLength {
+				// Without the incomplete last character
+				value = strings.ToValidUTF8(value[:l.maxValueLength], "")
+			}
+			truncated = append(truncated, value)
+		}
+		values = truncated
+	}
+	if l.maxValues > 0 && !fanOut && len(values) > l.maxValues {
+		if !l.exceeded(eventContext, key, limitValues) {
+			return nil, false
+		}
+		values = values[:l.maxValues]
+	}
+	if l.maxTotalBytes > 0 {
+		available := l.maxTotalBytes - metadataSize(eventContext, key) - len(key)
+		if valuesSize(values, fanOut) > available {
+			if !l.exceeded(eventContext, key, limitTotalBytes) {
+				return nil, false
+			}
+			// Only the values which fit are kept
+			fitting := make([]string, 0, len(values))
+			size := 0
+			for _, value := range values {
+				if !fanOut && size+len(value) > available {
+					break
+				}
+				if len(value) <= available {
+					fitting = append(fitting, value)
+					size += len(value)
+				}
+			}
+			if len(fitting) == 0 {
+				return nil, false
+			}
+			values = fitting
+		}
+	}
+	return values, true
+}
+
+func maxLength(values []string) int {
+	length := 0
+	for _, value := range values {
+		if len(value) > length {
+			length = len(value)
+		}
+	}
+	return length
+}
+
+// exceeded counts the limit and applies the policy, returns true if the
+// values have to be truncated
+func (l *metadataLimiter) exceeded(eventContext *eventContext, key, limit string) bool {
+	l.limited.Add(eventContext.ctx, 1, metric.WithAttributes(
+		l.processor,
+		attribute.String("key", key),
+		attribute.String("limit", limit),
+		attribute.String("policy", string(l.policy)),
+	))
+	switch l.policy {
+	case LIMIT_DROP:
+		eventContext.err = errDataDropped
+	case LIMIT_REJECT:
+		eventContext.err = consumererror.NewPermanent(
+			fmt.Errorf("metadata key %q over the %s limit", key, strings.ReplaceAll(limit, "_", " ")))
+	default:
+		return true
+	}
+	return false
+}
+
+// metadataSize is the size of the keys and values of the metadata without
+// the key, fan out keys only count their biggest value
+func metadataSize(eventContext *eventContext, without string) int {
+	size := 0
+	for key, values := range eventContext.newMetadata {
+		if key == without {
+			continue
+		}
+		size += len(key) + valuesSize(values, eventContext.isFanOutKey(key))
+	}
+	return size
+}
+
+func valuesSize(values []string, fanOut bool) int {
+	if fanOut {
+		return maxLength(values)
+	}
+	size := 0
+	for _, value := range values {
+		size += len(value)
+	}
+	return size
+}
@@ -0,0 +1,63 @@
+package contextprocessor
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/collector/client"
+	"go.opentelemetry.io/collector/pdata/plog"
+	"go.opentelemetry.io/collector/processor/processortest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestMetadataLimitsCredentials(t *testing.T) {
+	token := "abcdefghijklmnopqrstuvwxyz0123456789"
+	credentials := filepath.Join(t.TempDir(), "credentials.yaml")
+	require.NoError(t, os.WriteFile(credentials, []byte("team-a:\n  bearer_token: "+token+"\n"), 0o600))
+	key := "x-scope-orgid"
+	tenant := "team-a"
+	for _, policy := range []LimitPolicy{LIMIT_TRUNCATE, LIMIT_DROP, LIMIT_REJECT} {
+		t.Run(string(policy), func(t *testing.T) {
+			cfg := &Config{
+				ActionsConfig: []ActionConfig{{Key: &key, Action: UPSERT, ValueDefault: &tenant}},
+				Credentials:   &CredentialsConfig{MetadataKey: key, File: credentials},
+				MetadataLimits: &MetadataLimitsConfig{
+					MaxValueLength: 20,
+					Policy:         policy,
+				},
+			}
+			require.NoError(t, cfg.Validate())
+			sink := &testLogsSink{}
+			p, err := NewContextLogsProcessor(processortest.NewNopSettings(), sink, trace.WithAttributes(), cfg)
+			require.NoError(t, err)
+
+			ld := plog.NewLogs()
+			ld.ResourceLogs().AppendEmpty()
+			require.NoError(t, p.ConsumeLogs(context.Background(), ld))
+			require.Len(t, sink.contexts, 1)
+			// The secret is never truncated nor removed
+			metadata := client.FromContext(sink.contexts[0]).Metadata
+			assert.Equal(t, []string{"Bearer " + token}, metadata.Get("authorization"))
+			assert.Equal(t, []string{tenant}, metadata.Get(key))
+		})
+	}
+}
+
+func TestMetadataLimitsTruncate(t *testing.T) {
+	key := "x-scope-orgid"
+	ar := NewActionsRunner()
+	require.NoError(t, ar.AddAction(ActionConfig{Key: &key, Action: UPSERT, FromAttribute: AttributeNames{"tenant"}}))
+	limits, err := newMetadataLimiter(newTestMeter(), newTestProcessorID(), &MetadataLimitsConfig{MaxValueLength: 5})
+	require.NoError(t, err)
+	ar.limits = limits
+
+	ctxs, err := ar.Apply(context.Background(), newTestAttributes(map[string]any{"tenant": strings.Repeat("a", 10)}))
+	require.NoError(t, err)
+	require.Len(t, ctxs, 1)
+	assert.Equal(t, []string{"aaaaa"}, client.FromContext(ctxs[0]).Metadata.Get(key))
+}
@@ -2,36 +2,40 @@ package contextprocessor
 
 import (
 	"context"
+	"errors"
 
 	"go.opentelemetry.io/collector/consumer"
 	"go.opentelemetry.io/collector/pdata/plog"
+	"go.opentelemetry.io/collector/processor"
 	"go.opentelemetry.io/otel/trace"
-	"go.uber.org/zap"
 )
 
 type contextLogsProcessor struct {
 	contextProcessor
 	nextConsumer consumer.Logs
+	sizer        plog.MarshalSizer
+	// bodies are the from_body sources, the log records are split by their values
+	bodies []*bodyExtractor
 }
 
 func NewContextLogsProcessor(
-	logger *zap.Logger,
+	set processor.Settings,
 	nextConsumer consumer.Logs,
 	eventOptions trace.SpanStartEventOption,
-	actions []ActionConfig) (*contextLogsProcessor, error) {
-	aRunner := NewActionsRunner()
-	for _, action := range actions {
-		if err := aRunner.AddAction(action); err != nil {
-			return nil, err
-		}
+	cfg *Config) (*contextLogsProcessor, error) {
+	ctxt, err := newContextProcessor(set, eventOptions, cfg, "log_records")
+	if err != nil {
+		return nil, err
+	}
+	bodies, err := cfg.bodyExtractors()
+	if err != nil {
+		return nil, err
 	}
 	return &contextLogsProcessor{
-		contextProcessor: contextProcessor{
-			logger:        logger,
-			actionsRunner: aRunner,
-			eventOptions:  eventOptions,
-		},
-		nextConsumer: nextConsumer,
+		contextProcessor: *ctxt,
+		nextConsumer:     nextConsumer,
+		sizer:            &plog.ProtoMarshaler{},
+		bodies:           bodies,
 	}, nil
 }
 
@@ -39,15 +43,102 @@ func NewContextLogsProcessor(
 func (ctxt *contextLogsProcessor) ConsumeLogs(ctx context.Context, ld plog.Logs) (err error) {
 	span := trace.SpanFromContext(ctx)
 	span.AddEvent("Start processing.", ctxt.eventOptions)
+	d := ctxt.newDispatcher()
 	rsl := ld.ResourceLogs()
 	for i := 0; i < rsl.Len() && err == nil; i++ {
 		rl := rsl.At(i)
-		attrs := rl.Resource().Attributes()
-		newCtx := ctxt.actionsRunner.Apply(ctx, attrs)
-		newLd := plog.NewLogs()
-		rl.CopyTo(newLd.ResourceLogs().AppendEmpty())
-		err = ctxt.nextConsumer.ConsumeLogs(newCtx, newLd)
+		var groups []*bodyGroup
+		if len(ctxt.bodies) > 0 {
+			groups = splitByBody(rl, ctxt.bodies)
+		}
+		// Resources without log records are forwarded as they are
+		if len(groups) == 0 {
+			err = ctxt.consumeResource(ctx, d, rl, sourceValues{schemaURL: rl.SchemaUrl()})
+			continue
+		}
+		for j := 0; j < len(groups) && err == nil; j++ {
+			err = ctxt.consumeResource(ctx, d, groups[j].logs.ResourceLogs().At(0), sourceValues{body: groups[j].values, schemaURL: rl.SchemaUrl()})
+		}
 	}
+	err = d.wait(err)
 	span.AddEvent("End processing.", ctxt.eventOptions)
 	return err
 }
+
+// consumeResource applies the actions to the resource and forwards a copy
+// for each context
+func (ctxt *contextLogsProcessor) consumeResource(
+	ctx context.Context,
+	d *dispatcher,
+	rl plog.ResourceLogs,
+	values sourceValues) error {
+
+	copies, err := ctxt.actionsRunner.applyWithValues(ctx, rl.Resource().Attributes(), values)
+	if err != nil {
+		if errors.Is(err, errDataDropped) {
+			return nil
+		}
+		return err
+	}
+	copies = copies[:ctxt.fanOut.limit(ctx, len(copies))]
+	for j := 0; j < len(copies) && err == nil; j++ {
+		newLd := plog.NewLogs()
+		newR := newLd.ResourceLogs().AppendEmpty()
+		rl.CopyTo(newR)
+		copies[j].copyResourceTo(newR.Resource())
+		newCtx := copies[j].getContext()
+		for _, chunk := range ctxt.chunks(newLd) {
+			chunk := chunk
+			if err = d.send(func() error {
+				return ctxt.forward(newCtx, chunk)
+			}); err != nil {
+				break
+			}
+		}
+	}
+	return err
+}
+
+// chunks splits the log records within max_items and max_bytes, in order
+func (ctxt *contextLogsProcessor) chunks(ld plog.Logs) []plog.Logs {
+	if !ctxt.chunked() {
+		return []plog.Logs{ld}
+	}
+	payloads := []plog.Logs{ld}
+	order := ctxt.chunkOrder(
+		func(i int) int { return payloads[i].LogRecordCount() },
+		func(i int) int { return ctxt.sizer.LogsSize(payloads[i]) },
+		func(i, n int) int {
+			payloads = append(payloads, splitLogs(payloads[i], n))
+			return len(payloads) - 1
+		})
+	chunks := make([]plog.Logs, 0, len(order))
+	for _, i := range order {
+		chunks = append(chunks, payloads[i])
+	}
+	return chunks
+}
+
+// forward sends the data to the next consumer if it is not over the rate limit
+func (ctxt *contextLogsProcessor) forward(ctx context.Context, ld plog.Logs) error {
+	// Sizes are taken before, the next consumer owns the data afterwards
+	items, size := ld.LogRecordCount(), 0
+	if ctxt.limiter != nil {
+		if err := ctxt.limiter.acquire(ctx, items); err != nil {
+			if errors.Is(err, errDataDropped) {
+				return nil
+			}
+			return err
+		}
+	}
+	if ctxt.usage != nil {
+		size = ctxt.sizer.LogsSize(ld)
+	}
+	err := ctxt.timeout.call(ctx, func(ctx context.Context) error {
+		return ctxt.nextConsumer.ConsumeLogs(ctx, ld)
+	})
+	if err == nil && ctxt.usage != nil {
+		ctxt.usage.record(ctx, items, size)
+	}
+	return err
+}
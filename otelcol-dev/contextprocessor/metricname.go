@@ -0,0 +1,143 @@
+package contextprocessor
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"go.opentelemetry.io/collector/pdata/pmetric"
+)
+
+// metricNameMatcher gets the value of a from_metric_name source from the name
+// of a metric, the first matching mapping is used
+type metricNameMatcher struct {
+	id       string
+	mappings []metricNameMapping
+}
+
+type metricNameMapping struct {
+	prefix string
+	regex  *regexp.Regexp
+	value  string
+}
+
+// metricNameID identifies the from_metric_name sources with the same mappings
+func metricNameID(mappings []MetricNameMapping) string {
+	var id strings.Builder
+	for _, m := range mappings {
+		id.WriteString(m.Prefix + "\x00" + m.Regex + "\x00" + m.Value + "\x00")
+	}
+	return id.String()
+}
+
+// metricNameMatchers returns a matcher for each different from_metric_name
+// source of the actions and the rules
+func (cfg *Config) metricNameMatchers() ([]*metricNameMatcher, error) {
+	actions := cfg.actions()
+	for _, rule := range cfg.Rules {
+		actions = append(actions, rule.ActionsConfig...)
+	}
+	matchers := make([]*metricNameMatcher, 0)
+	seen := make(map[string]struct{})
+	for _, action := range actions {
+		if len(action.FromMetricName) == 0 {
+			continue
+		}
+		id := metricNameID(action.FromMetricName)
+		if _, exists := seen[id]; exists {
+			continue
+		}
+		seen[id] = struct{}{}
+		m := &metricNameMatcher{
+			id:       id,
+			mappings: make([]metricNameMapping, 0, len(action.FromMetricName)),
+		}
+		for _, mapping := range action.FromMetricName {
+			mm := metricNameMapping{
+				prefix: mapping.Prefix,
+				value:  mapping.Value,
+			}
+			if mapping.Regex != "" {
+				regex, err := regexp.Compile(mapping.Regex)
+				if err != nil {
+					return nil, err
+				}
+				mm.regex = regex
+			}
+			m.mappings = append(m.mappings, mm)
+		}
+		matchers = append(matchers, m)
+	}
+	return matchers, nil
+}
+
+// match returns the value of the first mapping matching the name
+func (m *metricNameMatcher) match(name string) (string, bool) {
+	for _, mapping := range m.mappings {
+		if mapping.regex == nil {
+			if strings.HasPrefix(name, mapping.prefix) {
+				return mapping.value, true
+			}
+			continue
+		}
+		if match := mapping.regex.FindStringSubmatchIndex(name); match != nil {
+			return string(mapping.regex.ExpandString(nil, mapping.value, name, match)), true
+		}
+	}
+	return "", false
+}
+
+// metricNameGroup is a copy of a resource with the metrics with the same values
+type metricNameGroup struct {
+	values  map[string]string
+	metrics pmetric.Metrics
+	scopes  map[int]pmetric.ScopeMetrics
+}
+
+// splitByMetricName returns a copy of the resource for each combination of
+// values of the matchers in the metrics, in order of appearance
+func splitByMetricName(rm pmetric.ResourceMetrics, matchers []*metricNameMatcher) []*metricNameGroup {
+	groups := make([]*metricNameGroup, 0, 1)
+	index := make(map[string]*metricNameGroup)
+	var key strings.Builder
+	sms := rm.ScopeMetrics()
+	for i := 0; i < sms.Len(); i++ {
+		sm := sms.At(i)
+		metrics := sm.Metrics()
+		for j := 0; j < metrics.Len(); j++ {
+			metric := metrics.At(j)
+			values := make(map[string]string, len(matchers))
+			key.Reset()
+			for _, m := range matchers {
+				if value, exists := m.match(metric.Name()); exists {
+					values[m.id] = value
+					fmt.Fprintf(&key, "1%d:%s", len(value), value)
+				} else {
+					key.WriteString("0")
+				}
+			}
+			group, exists := index[key.String()]
+			if !exists {
+				group = &metricNameGroup{
+					values:  values,
+					metrics: pmetric.NewMetrics(),
+					scopes:  make(map[int]pmetric.ScopeMetrics),
+				}
+				newRm := group.metrics.ResourceMetrics().AppendEmpty()
+				rm.Resource().CopyTo(newRm.Resource())
+				newRm.SetSchemaUrl(rm.SchemaUrl())
+				index[key.String()] = group
+				groups = append(groups, group)
+			}
+			scope, exists := group.scopes[i]
+			if !exists {
+				scope = group.metrics.ResourceMetrics().At(0).ScopeMetrics().AppendEmpty()
+				sm.Scope().CopyTo(scope.Scope())
+				scope.SetSchemaUrl(sm.SchemaUrl())
+				group.scopes[i] = scope
+			}
+			metric.CopyTo(scope.Metrics().AppendEmpty())
+		}
+	}
+	return groups
+}
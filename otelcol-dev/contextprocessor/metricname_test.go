@@ -0,0 +1,182 @@
+package contextprocessor
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/collector/client"
+	"go.opentelemetry.io/collector/consumer"
+	"go.opentelemetry.io/collector/pdata/pmetric"
+	"go.opentelemetry.io/collector/processor/processortest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// newTestMetricNameMatchers returns the matchers of an action with the mappings
+func newTestMetricNameMatchers(t *testing.T, mappings ...MetricNameMapping) []*metricNameMatcher {
+	key := "x-scope-orgid"
+	cfg := &Config{ActionsConfig: []ActionConfig{{Key: &key, Action: UPSERT, FromMetricName: mappings}}}
+	matchers, err := cfg.metricNameMatchers()
+	require.NoError(t, err)
+	require.Len(t, matchers, 1)
+	return matchers
+}
+
+func TestMetricNameMatch(t *testing.T) {
+	matcher := newTestMetricNameMatchers(t,
+		MetricNameMapping{Prefix: "payments_", Value: "payments"},
+		MetricNameMapping{Regex: "^(kafka|redis)_", Value: "team-$1"},
+		// Never used for payments_, the first matching mapping wins
+		MetricNameMapping{Regex: "_total$", Value: "counters"},
+	)[0]
+	tests := []struct {
+		name     string
+		expected string
+		ok       bool
+	}{
+		{name: "payments_requests_total", expected: "payments", ok: true},
+		{name: "kafka_lag", expected: "team-kafka", ok: true},
+		{name: "redis_hits_total", expected: "team-redis", ok: true},
+		{name: "http_requests_total", expected: "counters", ok: true},
+		{name: "http_duration_seconds"},
+		{name: "mykafka_lag"},
+	}
+	for _, tt := range tests {
+		value, ok := matcher.match(tt.name)
+		assert.Equal(t, tt.ok, ok, tt.name)
+		assert.Equal(t, tt.expected, value, tt.name)
+	}
+
+	key := "x-scope-orgid"
+	_, err := (&Config{ActionsConfig: []ActionConfig{{Key: &key, Action: UPSERT, FromMetricName: []MetricNameMapping{{Regex: "(", Value: "a"}}}}}).metricNameMatchers()
+	assert.Error(t, err)
+}
+
+// newTestNamedMetrics returns a resource with a scope for each list of metric names
+func newTestNamedMetrics(scopes ...[]string) pmetric.Metrics {
+	md := pmetric.NewMetrics()
+	rm := md.ResourceMetrics().AppendEmpty()
+	rm.Resource().Attributes().PutStr("tenant", "team-a")
+	for i, names := range scopes {
+		sm := rm.ScopeMetrics().AppendEmpty()
+		sm.Scope().SetName(string(rune('a' + i)))
+		for _, name := range names {
+			metric := sm.Metrics().AppendEmpty()
+			metric.SetName(name)
+			metric.SetEmptyGauge().DataPoints().AppendEmpty().SetIntValue(1)
+		}
+	}
+	return md
+}
+
+// metricNames returns the names of the metrics by scope
+func metricNames(md pmetric.Metrics) map[string][]string {
+	result := make(map[string][]string)
+	sms := md.ResourceMetrics().At(0).ScopeMetrics()
+	for i := 0; i < sms.Len(); i++ {
+		names := []string{}
+		for j := 0; j < sms.At(i).Metrics().Len(); j++ {
+			names = append(names, sms.At(i).Metrics().At(j).Name())
+		}
+		result[sms.At(i).Scope().Name()] = names
+	}
+	return result
+}
+
+func TestSplitByMetricName(t *testing.T) {
+	matchers := newTestMetricNameMatchers(t,
+		MetricNameMapping{Prefix: "payments_", Value: "payments"},
+		MetricNameMapping{Regex: "^(kafka|redis)_", Value: "team-$1"},
+	)
+	md := newTestNamedMetrics(
+		[]string{"kafka_lag", "payments_total", "up"},
+		[]string{"payments_errors", "redis_hits"},
+	)
+	groups := splitByMetricName(md.ResourceMetrics().At(0), matchers)
+	require.Len(t, groups, 4)
+
+	id := matchers[0].id
+	// The groups are in order of appearance, with the scopes of their metrics
+	expected := []struct {
+		value   string
+		metrics map[string][]string
+	}{
+		{value: "team-kafka", metrics: map[string][]string{"a": {"kafka_lag"}}},
+		{value: "payments", metrics: map[string][]string{"a": {"payments_total"}, "b": {"payments_errors"}}},
+		{metrics: map[string][]string{"a": {"up"}}},
+		{value: "team-redis", metrics: map[string][]string{"b": {"redis_hits"}}},
+	}
+	for i, group := range groups {
+		value, exists := group.values[id]
+		assert.Equal(t, expected[i].value != "", exists, i)
+		assert.Equal(t, expected[i].value, value, i)
+		assert.Equal(t, expected[i].metrics, metricNames(group.metrics), i)
+		tenant, _ := group.metrics.ResourceMetrics().At(0).Resource().Attributes().Get("tenant")
+		assert.Equal(t, "team-a", tenant.Str())
+	}
+}
+
+// testMetricsSink records the metrics and the contexts of the calls
+type testMetricsSink struct {
+	mutex    sync.Mutex
+	contexts []context.Context
+	metrics  []pmetric.Metrics
+}
+
+func (s *testMetricsSink) Capabilities() consumer.Capabilities {
+	return consumer.Capabilities{}
+}
+
+func (s *testMetricsSink) ConsumeMetrics(ctx context.Context, md pmetric.Metrics) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.contexts = append(s.contexts, ctx)
+	s.metrics = append(s.metrics, md)
+	return nil
+}
+
+func TestMetricsFromMetricName(t *testing.T) {
+	key := "x-scope-orgid"
+	value := "anonymous"
+	cfg := &Config{
+		ActionsConfig: []ActionConfig{{
+			Key:            &key,
+			Action:         UPSERT,
+			FromMetricName: []MetricNameMapping{{Prefix: "payments_", Value: "payments"}},
+			FromAttribute:  AttributeNames{"tenant"},
+			ValueDefault:   &value,
+		}},
+	}
+	require.NoError(t, cfg.Validate())
+	sink := &testMetricsSink{}
+	p, err := NewContextMetricsProcessor(processortest.NewNopSettings(), sink, trace.WithAttributes(), cfg)
+	require.NoError(t, err)
+
+	md := newTestNamedMetrics([]string{"payments_total", "up"})
+	// Without the attribute the value is used
+	other := md.ResourceMetrics().AppendEmpty()
+	other.ScopeMetrics().AppendEmpty().Metrics().AppendEmpty().SetName("up")
+	// A resource without metrics is forwarded as it is
+	empty := md.ResourceMetrics().AppendEmpty()
+	empty.Resource().Attributes().PutStr("tenant", "team-b")
+	empty.ScopeMetrics().AppendEmpty().Scope().SetName("empty")
+	require.NoError(t, p.ConsumeMetrics(context.Background(), md))
+
+	expected := []struct {
+		tenant  string
+		metrics map[string][]string
+	}{
+		{tenant: "payments", metrics: map[string][]string{"a": {"payments_total"}}},
+		// The metrics without mapping use the next sources
+		{tenant: "team-a", metrics: map[string][]string{"a": {"up"}}},
+		{tenant: "anonymous", metrics: map[string][]string{"": {"up"}}},
+		{tenant: "team-b", metrics: map[string][]string{"empty": {}}},
+	}
+	require.Len(t, sink.metrics, len(expected))
+	for i, sent := range sink.metrics {
+		assert.Equal(t, []string{expected[i].tenant}, client.FromContext(sink.contexts[i]).Metadata.Get(key), i)
+		assert.Equal(t, expected[i].metrics, metricNames(sent), i)
+	}
+}
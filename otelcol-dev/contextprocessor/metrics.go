@@ -2,36 +2,40 @@ package contextprocessor
 
 import (
 	"context"
+	"errors"
 
 	"go.opentelemetry.io/collector/consumer"
 	"go.opentelemetry.io/collector/pdata/pmetric"
+	"go.opentelemetry.io/collector/processor"
 	"go.opentelemetry.io/otel/trace"
-	"go.uber.org/zap"
 )
 
 type contextMetricsProcessor struct {
 	contextProcessor
 	nextConsumer consumer.Metrics
+	sizer        pmetric.MarshalSizer
+	// metricNames are the from_metric_name sources, the metrics are split by their values
+	metricNames []*metricNameMatcher
 }
 
 func NewContextMetricsProcessor(
-	logger *zap.Logger,
+	set processor.Settings,
 	nextConsumer consumer.Metrics,
 	eventOptions trace.SpanStartEventOption,
-	actions []ActionConfig) (*contextMetricsProcessor, error) {
-	aRunner := NewActionsRunner()
-	for _, action := range actions {
-		if err := aRunner.AddAction(action); err != nil {
-			return nil, err
-		}
+	cfg *Config) (*contextMetricsProcessor, error) {
+	ctxt, err := newContextProcessor(set, eventOptions, cfg, "metric_data_points")
+	if err != nil {
+		return nil, err
+	}
+	metricNames, err := cfg.metricNameMatchers()
+	if err != nil {
+		return nil, err
 	}
 	return &contextMetricsProcessor{
-		contextProcessor: contextProcessor{
-			logger:        logger,
-			actionsRunner: aRunner,
-			eventOptions:  eventOptions,
-		},
-		nextConsumer: nextConsumer,
+		contextProcessor: *ctxt,
+		nextConsumer:     nextConsumer,
+		sizer:            &pmetric.ProtoMarshaler{},
+		metricNames:      metricNames,
 	}, nil
 }
 
@@ -39,15 +43,102 @@ func NewContextMetricsProcessor(
 func (ctxt *contextMetricsProcessor) ConsumeMetrics(ctx context.Context, md pmetric.Metrics) (err error) {
 	span := trace.SpanFromContext(ctx)
 	span.AddEvent("Start processing.", ctxt.eventOptions)
+	d := ctxt.newDispatcher()
 	rms := md.ResourceMetrics()
 	for i := 0; i < rms.Len() && err == nil; i++ {
 		rm := rms.At(i)
-		attrs := rm.Resource().Attributes()
-		newCtx := ctxt.actionsRunner.Apply(ctx, attrs)
-		newMd := pmetric.NewMetrics()
-		rm.CopyTo(newMd.ResourceMetrics().AppendEmpty())
-		err = ctxt.nextConsumer.ConsumeMetrics(newCtx, newMd)
+		var groups []*metricNameGroup
+		if len(ctxt.metricNames) > 0 {
+			groups = splitByMetricName(rm, ctxt.metricNames)
+		}
+		// Resources without metrics are forwarded as they are
+		if len(groups) == 0 {
+			err = ctxt.consumeResource(ctx, d, rm, sourceValues{schemaURL: rm.SchemaUrl()})
+			continue
+		}
+		for j := 0; j < len(groups) && err == nil; j++ {
+			err = ctxt.consumeResource(ctx, d, groups[j].metrics.ResourceMetrics().At(0), sourceValues{metricName: groups[j].values, schemaURL: rm.SchemaUrl()})
+		}
 	}
+	err = d.wait(err)
 	span.AddEvent("End processing.", ctxt.eventOptions)
 	return err
 }
+
+// consumeResource applies the actions to the resource and forwards a copy
+// for each context
+func (ctxt *contextMetricsProcessor) consumeResource(
+	ctx context.Context,
+	d *dispatcher,
+	rm pmetric.ResourceMetrics,
+	values sourceValues) error {
+
+	copies, err := ctxt.actionsRunner.applyWithValues(ctx, rm.Resource().Attributes(), values)
+	if err != nil {
+		if errors.Is(err, errDataDropped) {
+			return nil
+		}
+		return err
+	}
+	copies = copies[:ctxt.fanOut.limit(ctx, len(copies))]
+	for j := 0; j < len(copies) && err == nil; j++ {
+		newMd := pmetric.NewMetrics()
+		newR := newMd.ResourceMetrics().AppendEmpty()
+		rm.CopyTo(newR)
+		copies[j].copyResourceTo(newR.Resource())
+		newCtx := copies[j].getContext()
+		for _, chunk := range ctxt.chunks(newMd) {
+			chunk := chunk
+			if err = d.send(func() error {
+				return ctxt.forward(newCtx, chunk)
+			}); err != nil {
+				break
+			}
+		}
+	}
+	return err
+}
+
+// chunks splits the data points within max_items and max_bytes, in order
+func (ctxt *contextMetricsProcessor) chunks(md pmetric.Metrics) []pmetric.Metrics {
+	if !ctxt.chunked() {
+		return []pmetric.Metrics{md}
+	}
+	payloads := []pmetric.Metrics{md}
+	order := ctxt.chunkOrder(
+		func(i int) int { return payloads[i].DataPointCount() },
+		func(i int) int { return ctxt.sizer.MetricsSize(payloads[i]) },
+		func(i, n int) int {
+			payloads = append(payloads, splitMetrics(payloads[i], n))
+			return len(payloads) - 1
+		})
+	chunks := make([]pmetric.Metrics, 0, len(order))
+	for _, i := range order {
+		chunks = append(chunks, payloads[i])
+	}
+	return chunks
+}
+
+// forward sends the data to the next consumer if it is not over the rate limit
+func (ctxt *contextMetricsProcessor) forward(ctx context.Context, md pmetric.Metrics) error {
+	// Sizes are taken before, the next consumer owns the data afterwards
+	items, size := md.DataPointCount(), 0
+	if ctxt.limiter != nil {
+		if err := ctxt.limiter.acquire(ctx, items); err != nil {
+			if errors.Is(err, errDataDropped) {
+				return nil
+			}
+			return err
+		}
+	}
+	if ctxt.usage != nil {
+		size = ctxt.sizer.MetricsSize(md)
+	}
+	err := ctxt.timeout.call(ctx, func(ctx context.Context) error {
+		return ctxt.nextConsumer.ConsumeMetrics(ctx, md)
+	})
+	if err == nil && ctxt.usage != nil {
+		ctxt.usage.record(ctx, items, size)
+	}
+	return err
+}
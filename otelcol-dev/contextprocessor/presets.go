@@ -0,0 +1,113 @@
+package contextprocessor
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Preset is a backend whose usual actions are generated from the tenant settings
+type Preset string
+
+const (
+	// Mimir, Loki and Tempo use the same X-Scope-OrgID header
+	PRESET_GRAFANA_LGTM Preset = "grafana-lgtm"
+	PRESET_MIMIR        Preset = "mimir"
+	PRESET_LOKI         Preset = "loki"
+	PRESET_TEMPO        Preset = "tempo"
+	PRESET_CORTEX       Preset = "cortex"
+	PRESET_SPLUNK       Preset = "splunk"
+)
+
+const (
+	// Value used when tenant_default is not defined
+	defaultTenant = "anonymous"
+)
+
+// presetSettings define the action generated by a preset, the key is the one
+// to forward with headers_setter
+type presetSettings struct {
+	key      string
+	sanitize SanitizePreset
+}
+
+var presets = map[Preset]presetSettings{
+	PRESET_GRAFANA_LGTM: {key: "x-scope-orgid", sanitize: SANITIZE_MIMIR},
+	PRESET_MIMIR:        {key: "x-scope-orgid", sanitize: SANITIZE_MIMIR},
+	PRESET_LOKI:         {key: "x-scope-orgid", sanitize: SANITIZE_LOKI},
+	PRESET_TEMPO:        {key: "x-scope-orgid", sanitize: SANITIZE_TEMPO},
+	PRESET_CORTEX:       {key: "x-scope-orgid", sanitize: SANITIZE_CORTEX},
+	PRESET_SPLUNK:       {key: "x-splunk-index"},
+}
+
+// presetActions expands the preset into the list of actions
+func (cfg *Config) presetActions() []ActionConfig {
+	settings, exists := presets[cfg.Preset]
+	if !exists {
+		return nil
+	}
+	key := settings.key
+	value := defaultTenant
+	if cfg.TenantDefault != nil {
+		value = *cfg.TenantDefault
+	}
+	return []ActionConfig{
+		{
+			Key:           &key,
+			Action:        UPSERT,
+			ValueDefault:  &value,
+			FromAttribute: cfg.TenantFrom,
+			Sanitize:      settings.sanitize,
+		},
+	}
+}
+
+// actions returns the actions generated by the preset followed by the ones
+// explicitly defined
+func (cfg *Config) actions() []ActionConfig {
+	return cfg.withDefaults(append(cfg.presetActions(), cfg.ActionsConfig...))
+}
+
+// rules returns the rules with the global settings in their actions
+func (cfg *Config) rules() []RuleConfig {
+	rules := make([]RuleConfig, 0, len(cfg.Rules))
+	for _, rule := range cfg.Rules {
+		rule.ActionsConfig = cfg.withDefaults(rule.ActionsConfig)
+		rules = append(rules, rule)
+	}
+	return rules
+}
+
+// withDefaults returns a copy of the actions with the global settings which
+// are not defined in the action
+func (cfg *Config) withDefaults(actions []ActionConfig) []ActionConfig {
+	result := make([]ActionConfig, 0, len(actions))
+	for _, action := range actions {
+		if action.EmptyAsMissing == nil {
+			emptyAsMissing := cfg.EmptyAsMissing
+			action.EmptyAsMissing = &emptyAsMissing
+		}
+		result = append(result, action)
+	}
+	return result
+}
+
+// validatePreset checks the preset and the explicit actions do not conflict
+func (cfg *Config) validatePreset() error {
+	settings, exists := presets[cfg.Preset]
+	if !exists {
+		return errInvalidPreset
+	}
+	if len(cfg.TenantFrom) == 0 {
+		return errMissingPresetTenantFrom
+	}
+	actions := append([]ActionConfig{}, cfg.ActionsConfig...)
+	for _, rule := range cfg.Rules {
+		actions = append(actions, rule.ActionsConfig...)
+	}
+	for _, action := range actions {
+		if action.Key != nil && strings.EqualFold(*action.Key, settings.key) {
+			return fmt.Errorf("action on key %q conflicts with preset %q", *action.Key, cfg.Preset)
+		}
+	}
+	return nil
+}
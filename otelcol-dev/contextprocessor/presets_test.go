@@ -0,0 +1,131 @@
+package contextprocessor
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/collector/client"
+)
+
+func TestPresetActions(t *testing.T) {
+	tenant := "shared"
+	team := "team"
+	cfg := &Config{
+		Preset:        PRESET_LOKI,
+		TenantFrom:    AttributeNames{"tenant", "k8s.namespace.name"},
+		ActionsConfig: []ActionConfig{{Key: &team, Action: INSERT, FromAttribute: AttributeNames{"team"}}},
+	}
+	require.NoError(t, cfg.Validate())
+	actions := cfg.actions()
+	require.Len(t, actions, 2)
+	// The preset action is the first one
+	assert.Equal(t, "x-scope-orgid", *actions[0].Key)
+	assert.Equal(t, UPSERT, actions[0].Action)
+	assert.Equal(t, AttributeNames{"tenant", "k8s.namespace.name"}, actions[0].FromAttribute)
+	assert.Equal(t, SANITIZE_LOKI, actions[0].Sanitize)
+	assert.Equal(t, defaultTenant, *actions[0].ValueDefault)
+	assert.Equal(t, "team", *actions[1].Key)
+
+	cfg.TenantDefault = &tenant
+	assert.Equal(t, "shared", *cfg.actions()[0].ValueDefault)
+
+	cfg = &Config{Preset: PRESET_SPLUNK, TenantFrom: AttributeNames{"index"}}
+	require.NoError(t, cfg.Validate())
+	actions = cfg.actions()
+	require.Len(t, actions, 1)
+	assert.Equal(t, "x-splunk-index", *actions[0].Key)
+	assert.Empty(t, actions[0].Sanitize)
+}
+
+func TestPresetApply(t *testing.T) {
+	tenant := "shared"
+	cfg := &Config{Preset: PRESET_MIMIR, TenantFrom: AttributeNames{"tenant"}, TenantDefault: &tenant}
+	require.NoError(t, cfg.Validate())
+	ar := NewActionsRunner()
+	for _, action := range cfg.actions() {
+		require.NoError(t, ar.AddAction(action))
+	}
+	// Without the attribute tenant_default is used
+	for _, tt := range []struct {
+		attrs    map[string]any
+		expected string
+	}{
+		{attrs: map[string]any{"tenant": "team-a"}, expected: "team-a"},
+		{attrs: map[string]any{"service.name": "web"}, expected: "shared"},
+	} {
+		ctxs, err := ar.Apply(context.Background(), newTestAttributes(tt.attrs))
+		require.NoError(t, err)
+		require.Len(t, ctxs, 1)
+		assert.Equal(t, []string{tt.expected}, client.FromContext(ctxs[0]).Metadata.Get("x-scope-orgid"))
+	}
+}
+
+func TestValidatePreset(t *testing.T) {
+	key := "X-Scope-OrgID"
+	other := "team"
+	value := "a"
+	conflict := ActionConfig{Key: &key, Action: UPSERT, ValueDefault: &value}
+	tests := []struct {
+		name string
+		cfg  *Config
+		err  string
+	}{
+		{
+			name: "valid",
+			cfg: &Config{
+				Preset:        PRESET_TEMPO,
+				TenantFrom:    AttributeNames{"tenant"},
+				ActionsConfig: []ActionConfig{{Key: &other, Action: UPSERT, ValueDefault: &value}},
+			},
+		},
+		{
+			name: "unknown preset",
+			cfg:  &Config{Preset: "jaeger", TenantFrom: AttributeNames{"tenant"}},
+			err:  errInvalidPreset.Error(),
+		},
+		{
+			name: "without tenant_from",
+			cfg:  &Config{Preset: PRESET_MIMIR},
+			err:  errMissingPresetTenantFrom.Error(),
+		},
+		{
+			name: "tenant settings without preset",
+			cfg:  &Config{TenantFrom: AttributeNames{"tenant"}},
+			err:  errMissingPreset.Error(),
+		},
+		{
+			// The keys are compared case-insensitively
+			name: "conflict with the actions",
+			cfg: &Config{
+				Preset:        PRESET_MIMIR,
+				TenantFrom:    AttributeNames{"tenant"},
+				ActionsConfig: []ActionConfig{conflict},
+			},
+			err: `action on key "X-Scope-OrgID" conflicts with preset "mimir"`,
+		},
+		{
+			name: "conflict with the rules",
+			cfg: &Config{
+				Preset:     PRESET_GRAFANA_LGTM,
+				TenantFrom: AttributeNames{"tenant"},
+				Rules: []RuleConfig{{
+					Match:         MatchConfig{Attributes: map[string]string{"env": "dev"}},
+					ActionsConfig: []ActionConfig{conflict},
+				}},
+			},
+			err: `action on key "X-Scope-OrgID" conflicts with preset "grafana-lgtm"`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.cfg.Validate()
+			if tt.err == "" {
+				assert.NoError(t, err)
+				return
+			}
+			assert.EqualError(t, err, tt.err)
+		})
+	}
+}
@@ -4,21 +4,158 @@ import (
 	"context"
 
 	"go.opentelemetry.io/collector/component"
+	"go.opentelemetry.io/collector/processor"
+	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/trace"
 	"go.uber.org/zap"
 )
 
+const (
+	// Instrumentation scope of the internal metrics
+	scopeName = "github.com/jriguera/opentelemetry-collector-contrib/processor/contextprocessor"
+)
+
 type contextProcessor struct {
 	logger        *zap.Logger
 	actionsRunner *ActionsRunner
-	cancel        context.CancelFunc
-	eventOptions  trace.SpanStartEventOption
+	usage         *usageRecorder
+	limiter       *rateLimiter
+	fanOut        *fanOutLimiter
+	timeout       *callTimeout
+	// concurrency is the number of workers sending the payloads
+	concurrency int
+	// maxItems and maxBytes split the payloads in chunks
+	maxItems int
+	maxBytes int
+	// files are checked for changes while the processor is running
+	files []*reloadableFile
+	// background functions run until the processor is shut down
+	background   []func(context.Context)
+	cancel       context.CancelFunc
+	eventOptions trace.SpanStartEventOption
+}
+
+// Builds the parts shared by all signals, signal is the name of the items
+// processed (spans, log_records, metric_data_points)
+func newContextProcessor(
+	set processor.Settings,
+	eventOptions trace.SpanStartEventOption,
+	cfg *Config,
+	signal string) (*contextProcessor, error) {
+
+	aRunner := NewActionsRunner()
+	aRunner.aliases = newAttributeAliases(cfg.SemconvAliases, cfg.AttributeAliases)
+	for _, action := range cfg.actions() {
+		if err := aRunner.AddAction(action); err != nil {
+			return nil, err
+		}
+	}
+	if len(cfg.Rules) > 0 {
+		rules, err := newRuleSet(cfg.rules())
+		if err != nil {
+			return nil, err
+		}
+		aRunner.addAction(rules)
+	}
+	ctxt := &contextProcessor{
+		logger:        set.Logger,
+		actionsRunner: aRunner,
+		concurrency:   cfg.Concurrency,
+		maxItems:      cfg.MaxItems,
+		maxBytes:      cfg.MaxBytes,
+		eventOptions:  eventOptions,
+	}
+	meter := set.MeterProvider.Meter(scopeName)
+	id := attribute.String("processor", set.ID.String())
+	if len(cfg.Usage.MetadataKeys) > 0 {
+		usage, err := newUsageRecorder(set.Logger, meter, id, signal, cfg.Usage)
+		if err != nil {
+			return nil, err
+		}
+		ctxt.usage = usage
+	}
+	if cfg.MetadataLimits != nil {
+		limits, err := newMetadataLimiter(meter, id, cfg.MetadataLimits)
+		if err != nil {
+			return nil, err
+		}
+		aRunner.limits = limits
+	}
+	if cfg.Cache != nil {
+		// Only the actions and rules are cached
+		cache, err := newMetadataCache(meter, id, cfg, len(aRunner.actions))
+		if err != nil {
+			return nil, err
+		}
+		aRunner.cache = cache
+	}
+	// Guards, enrichment and credentials are applied after the actions and rules
+	for _, limit := range cfg.CardinalityLimits {
+		guard, err := newCardinalityGuard(set.Logger, meter, id, limit)
+		if err != nil {
+			return nil, err
+		}
+		aRunner.addGuardAction(guard)
+	}
+	if cfg.Enrichment != nil {
+		enricher, err := newRegistryEnricher(set.Logger, cfg.Enrichment)
+		if err != nil {
+			return nil, err
+		}
+		// Each copy of the resource has the attributes of its own tenant
+		aRunner.addResourceCopyAction(enricher)
+		ctxt.files = append(ctxt.files, enricher.file)
+	}
+	if cfg.Credentials != nil {
+		credentials, err := newCredentialsSetter(set.Logger, cfg.Credentials)
+		if err != nil {
+			return nil, err
+		}
+		// Each copy of the resource has its own tenant
+		aRunner.addCopyAction(credentials)
+		if aRunner.limits != nil {
+			aRunner.limits.exempt(credentials.targetKey)
+		}
+		if credentials.file != nil {
+			ctxt.files = append(ctxt.files, credentials.file)
+		}
+	}
+	if cfg.PublishKeys {
+		// It has to be the last action
+		aRunner.addCopyAction(&keysPublisher{})
+	}
+	fanOut, err := newFanOutLimiter(set.Logger, meter, id, signal, cfg.MaxFanOut)
+	if err != nil {
+		return nil, err
+	}
+	ctxt.fanOut = fanOut
+	if cfg.Timeout > 0 {
+		timeout, err := newCallTimeout(set.Logger, meter, id, signal, cfg.Timeout, cfg.TimeoutMetadataKey)
+		if err != nil {
+			return nil, err
+		}
+		ctxt.timeout = timeout
+	}
+	if cfg.RateLimit != nil {
+		limiter, err := newRateLimiter(set.Logger, meter, id, signal, cfg.RateLimit)
+		if err != nil {
+			return nil, err
+		}
+		ctxt.limiter = limiter
+	}
+	return ctxt, nil
 }
 
 // implements https://pkg.go.dev/go.opentelemetry.io/collector/component#Component  Start
 func (ctxt *contextProcessor) Start(ctx context.Context, host component.Host) error {
 	ctx = context.Background()
 	ctx, ctxt.cancel = context.WithCancel(ctx)
+	for _, f := range ctxt.files {
+		go f.watch(ctx)
+	}
+	for _, f := range ctxt.background {
+		go f(ctx)
+	}
 	for k, _ := range host.GetExtensions() {
 		ctxt.logger.Info("Extension", zap.String("id", k.String()))
 	}
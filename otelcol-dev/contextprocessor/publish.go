@@ -0,0 +1,25 @@
+package contextprocessor
+
+import (
+	"sort"
+)
+
+const (
+	// Metadata key with the list of keys set by the processor
+	publishedKeysKey = "context-metadata-keys"
+)
+
+// keysPublisher is an Action which sets the list of metadata keys in the
+// context, so extensions can find them
+type keysPublisher struct{}
+
+func (p *keysPublisher) execute(eventContext *eventContext) {
+	keys := make([]string, 0, len(eventContext.newMetadata))
+	for key := range eventContext.newMetadata {
+		if key != publishedKeysKey {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	eventContext.setContextKey(publishedKeysKey, keys)
+}
@@ -0,0 +1,216 @@
+package contextprocessor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/collector/client"
+	"go.opentelemetry.io/collector/consumer/consumererror"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.uber.org/zap"
+)
+
+const (
+	// Buckets not used during this period are removed
+	rateLimitPruneInterval = time.Minute
+	// Number of tenants used as label of the metrics by default
+	defaultRateLimitCardinality = 1000
+)
+
+var (
+	// errDataDropped is not returned to the previous component, it signals
+	// the data has to be discarded
+	errDataDropped = errors.New("data dropped")
+	// errRateLimited is a retryable error, the previous component can try again later
+	errRateLimited = errors.New("rate limit exceeded")
+)
+
+// takeResult is the outcome of taking tokens from a bucket
+type takeResult int
+
+const (
+	taken takeResult = iota
+	// notEnough tokens now, they can be taken later
+	notEnough
+	// overBurst is a batch bigger than the bucket, it is never accepted
+	overBurst
+)
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// rateLimiter keeps a token bucket per tenant for one signal
+type rateLimiter struct {
+	logger      *zap.Logger
+	key         string
+	mode        RateLimitMode
+	defaultRate RateLimit
+	overrides   map[string]RateLimit
+	processor   attribute.KeyValue
+	limited     metric.Int64Counter
+	now         func() time.Time
+	mu          sync.Mutex
+	buckets     map[string]*tokenBucket
+	lastPrune   time.Time
+	// labels are the tenants used as label of the metric, up to maxCardinality
+	maxCardinality int
+	labels         map[string]struct{}
+}
+
+// selects the limits of the signal, signal is the name of the items processed
+func signalRateLimit(limits RateLimits, signal string) RateLimit {
+	switch signal {
+	case "spans":
+		return limits.Spans
+	case "log_records":
+		return limits.LogRecords
+	default:
+		return limits.MetricDataPoints
+	}
+}
+
+func newRateLimiter(
+	logger *zap.Logger,
+	meter metric.Meter,
+	processor attribute.KeyValue,
+	signal string,
+	cfg *RateLimitConfig) (*rateLimiter, error) {
+
+	limited, err := meter.Int64Counter(
+		"processor_context_rate_limited_"+signal,
+		metric.WithDescription("Number of "+strings.ReplaceAll(signal, "_", " ")+" over the rate limit"),
+		metric.WithUnit("{"+signal+"}"),
+	)
+	if err != nil {
+		return nil, err
+	}
+	mode := cfg.Mode
+	if mode == "" {
+		mode = DROP
+	}
+	defaultRate := signalRateLimit(cfg.Default, signal)
+	overrides := make(map[string]RateLimit, len(cfg.Overrides))
+	for tenant, limits := range cfg.Overrides {
+		if rate := signalRateLimit(limits, signal); rate.Rate > 0 {
+			overrides[tenant] = rate
+		}
+	}
+	maxCardinality := cfg.MaxCardinality
+	if maxCardinality == 0 {
+		maxCardinality = defaultRateLimitCardinality
+	}
+	now := time.Now
+	return &rateLimiter{
+		logger:         logger,
+		key:            cfg.MetadataKey,
+		mode:           mode,
+		defaultRate:    defaultRate,
+		overrides:      overrides,
+		processor:      processor,
+		limited:        limited,
+		now:            now,
+		buckets:        make(map[string]*tokenBucket),
+		lastPrune:      now(),
+		maxCardinality: maxCardinality,
+		labels:         make(map[string]struct{}),
+	}, nil
+}
+
+func (rl *rateLimiter) limit(tenant string) RateLimit {
+	limit, exists := rl.overrides[tenant]
+	if !exists {
+		limit = rl.defaultRate
+	}
+	if limit.Burst == 0 {
+		limit.Burst = limit.Rate
+	}
+	return limit
+}
+
+// takes the tokens from the bucket of the tenant
+func (rl *rateLimiter) take(tenant string, items int) takeResult {
+	limit := rl.limit(tenant)
+	if limit.Rate <= 0 {
+		return taken
+	}
+	if float64(items) > limit.Burst {
+		return overBurst
+	}
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	now := rl.now()
+	if now.Sub(rl.lastPrune) > rateLimitPruneInterval {
+		// Full buckets are removed, they are equivalent to new ones
+		for t, b := range rl.buckets {
+			l := rl.limit(t)
+			if b.tokens+now.Sub(b.last).Seconds()*l.Rate >= l.Burst {
+				delete(rl.buckets, t)
+			}
+		}
+		rl.lastPrune = now
+	}
+	bucket, exists := rl.buckets[tenant]
+	if !exists {
+		bucket = &tokenBucket{tokens: limit.Burst, last: now}
+		rl.buckets[tenant] = bucket
+	}
+	bucket.tokens += now.Sub(bucket.last).Seconds() * limit.Rate
+	if bucket.tokens > limit.Burst {
+		bucket.tokens = limit.Burst
+	}
+	bucket.last = now
+	if bucket.tokens < float64(items) {
+		return notEnough
+	}
+	bucket.tokens -= float64(items)
+	return taken
+}
+
+// label returns the tenant as label of the metric, or the overflow value when
+// there are too many different ones
+func (rl *rateLimiter) label(tenant string) string {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	if _, exists := rl.labels[tenant]; exists {
+		return tenant
+	}
+	if len(rl.labels) >= rl.maxCardinality {
+		return defaultOverflowValue
+	}
+	rl.labels[tenant] = struct{}{}
+	return tenant
+}
+
+// acquire checks the limits of the tenant of the context, returns nil if the
+// data can be forwarded, errDataDropped if it has to be discarded or
+// errRateLimited to reject it. A batch bigger than the burst is rejected with
+// a permanent error, it would never be accepted.
+func (rl *rateLimiter) acquire(ctx context.Context, items int) error {
+	tenant := strings.Join(client.FromContext(ctx).Metadata.Get(rl.key), ",")
+	result := rl.take(tenant, items)
+	if result == taken {
+		return nil
+	}
+	rl.limited.Add(ctx, int64(items), metric.WithAttributes(
+		rl.processor,
+		attribute.String(rl.key, rl.label(tenant)),
+		attribute.String("mode", string(rl.mode)),
+	))
+	rl.logger.Debug("Rate limit exceeded",
+		zap.String(rl.key, tenant), zap.Int("items", items), zap.String("mode", string(rl.mode)))
+	switch {
+	case rl.mode != REJECT:
+		return errDataDropped
+	case result == overBurst:
+		return consumererror.NewPermanent(
+			fmt.Errorf("%w for %s %q, %d items over the burst", errRateLimited, rl.key, tenant, items))
+	}
+	return fmt.Errorf("%w for %s %q", errRateLimited, rl.key, tenant)
+}
@@ -0,0 +1,134 @@
+package contextprocessor
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/collector/client"
+	"go.opentelemetry.io/collector/consumer/consumererror"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.uber.org/zap"
+)
+
+// newTestRateLimiter returns a log records limiter with a fake clock
+func newTestRateLimiter(t *testing.T, meter metric.Meter, cfg *RateLimitConfig, now *time.Time) *rateLimiter {
+	cfg.MetadataKey = "x-scope-orgid"
+	require.NoError(t, cfg.Validate())
+	rl, err := newRateLimiter(zap.NewNop(), meter, newTestProcessorID(), "log_records", cfg)
+	require.NoError(t, err)
+	rl.now = func() time.Time { return *now }
+	rl.lastPrune = *now
+	return rl
+}
+
+func newTestTenantContext(tenant string) context.Context {
+	return client.NewContext(context.Background(), client.Info{
+		Metadata: client.NewMetadata(map[string][]string{"x-scope-orgid": {tenant}}),
+	})
+}
+
+func TestRateLimiterRefill(t *testing.T) {
+	now := time.Now()
+	rl := newTestRateLimiter(t, newTestMeter(), &RateLimitConfig{
+		Default: RateLimits{LogRecords: RateLimit{Rate: 10, Burst: 20}},
+	}, &now)
+
+	assert.Equal(t, taken, rl.take("team-a", 20))
+	assert.Equal(t, notEnough, rl.take("team-a", 1))
+	now = now.Add(500 * time.Millisecond)
+	assert.Equal(t, taken, rl.take("team-a", 5))
+	assert.Equal(t, notEnough, rl.take("team-a", 1))
+	// The bucket is never over the burst
+	now = now.Add(time.Hour)
+	assert.Equal(t, taken, rl.take("team-a", 20))
+	assert.Equal(t, notEnough, rl.take("team-a", 1))
+	// Each tenant has its own bucket
+	assert.Equal(t, taken, rl.take("team-b", 20))
+	assert.Equal(t, overBurst, rl.take("team-b", 21))
+}
+
+func TestRateLimiterOverrides(t *testing.T) {
+	now := time.Now()
+	rl := newTestRateLimiter(t, newTestMeter(), &RateLimitConfig{
+		Default: RateLimits{LogRecords: RateLimit{Rate: 10}},
+		Overrides: map[string]RateLimits{
+			"team-a": {LogRecords: RateLimit{Rate: 100, Burst: 200}},
+			// Without log records limit the default is used
+			"team-b": {Spans: RateLimit{Rate: 1}},
+		},
+	}, &now)
+
+	assert.Equal(t, taken, rl.take("team-a", 200))
+	// The burst defaults to the rate
+	assert.Equal(t, overBurst, rl.take("team-b", 11))
+	assert.Equal(t, taken, rl.take("team-b", 10))
+	assert.Equal(t, taken, rl.take("team-c", 10))
+	assert.Equal(t, notEnough, rl.take("team-c", 1))
+
+	rl = newTestRateLimiter(t, newTestMeter(), &RateLimitConfig{
+		Overrides: map[string]RateLimits{"team-a": {LogRecords: RateLimit{Rate: 1}}},
+	}, &now)
+	// Without default the other tenants are not limited
+	assert.Equal(t, taken, rl.take("team-b", 1000))
+	assert.Equal(t, overBurst, rl.take("team-a", 2))
+}
+
+func TestRateLimiterPrune(t *testing.T) {
+	now := time.Now()
+	rl := newTestRateLimiter(t, newTestMeter(), &RateLimitConfig{
+		Default: RateLimits{LogRecords: RateLimit{Rate: 1, Burst: 1000}},
+	}, &now)
+
+	rl.take("team-a", 1000)
+	rl.take("team-b", 1)
+	now = now.Add(2 * time.Minute)
+	rl.take("team-c", 1)
+	// team-b refilled its bucket, team-a did not
+	assert.Len(t, rl.buckets, 2)
+	assert.Contains(t, rl.buckets, "team-a")
+	assert.Contains(t, rl.buckets, "team-c")
+}
+
+func TestRateLimiterModes(t *testing.T) {
+	now := time.Now()
+	limits := RateLimits{LogRecords: RateLimit{Rate: 1, Burst: 10}}
+	ctx := newTestTenantContext("team-a")
+
+	rl := newTestRateLimiter(t, newTestMeter(), &RateLimitConfig{Default: limits}, &now)
+	require.NoError(t, rl.acquire(ctx, 10))
+	assert.ErrorIs(t, rl.acquire(ctx, 1), errDataDropped)
+	assert.ErrorIs(t, rl.acquire(ctx, 11), errDataDropped)
+
+	rl = newTestRateLimiter(t, newTestMeter(), &RateLimitConfig{Mode: REJECT, Default: limits}, &now)
+	require.NoError(t, rl.acquire(ctx, 10))
+	err := rl.acquire(ctx, 1)
+	assert.ErrorIs(t, err, errRateLimited)
+	assert.False(t, consumererror.IsPermanent(err))
+	// A batch bigger than the burst is never accepted
+	err = rl.acquire(ctx, 11)
+	assert.ErrorIs(t, err, errRateLimited)
+	assert.True(t, consumererror.IsPermanent(err))
+}
+
+func TestRateLimiterCardinality(t *testing.T) {
+	now := time.Now()
+	meter, reader := newTestMetricReader()
+	rl := newTestRateLimiter(t, meter, &RateLimitConfig{
+		Default:        RateLimits{LogRecords: RateLimit{Rate: 1}},
+		MaxCardinality: 1,
+	}, &now)
+
+	for _, tenant := range []string{"team-a", "team-b", "team-c", "team-a"} {
+		assert.ErrorIs(t, rl.acquire(newTestTenantContext(tenant), 2), errDataDropped)
+	}
+	counts := make(map[string]int64)
+	for _, point := range collectSum(t, reader, "processor_context_rate_limited_log_records") {
+		tenant, _ := point.Attributes.Value(attribute.Key("x-scope-orgid"))
+		counts[tenant.AsString()] = point.Value
+	}
+	assert.Equal(t, map[string]int64{"team-a": 4, defaultOverflowValue: 4}, counts)
+}
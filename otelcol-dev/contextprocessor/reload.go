@@ -0,0 +1,90 @@
+package contextprocessor
+
+import (
+	"context"
+	"os"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// defaultReloadInterval is used when the interval is not set, the files have
+// tenants and secrets which change while the collector runs
+const defaultReloadInterval = time.Minute
+
+// reloadableFile reads a file and checks periodically if it changed, calling
+// load with the new content. If load fails the previous content is kept.
+type reloadableFile struct {
+	logger   *zap.Logger
+	path     string
+	interval time.Duration
+	load     func([]byte) error
+	modTime  time.Time
+	size     int64
+}
+
+func newReloadableFile(
+	logger *zap.Logger,
+	path string,
+	interval time.Duration,
+	load func([]byte) error) (*reloadableFile, error) {
+
+	// A negative interval disables reloading
+	if interval == 0 {
+		interval = defaultReloadInterval
+	}
+	f := &reloadableFile{
+		logger:   logger,
+		path:     path,
+		interval: interval,
+		load:     load,
+	}
+	if _, err := f.reload(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// reload calls load if the file changed, returns true if it was loaded
+func (f *reloadableFile) reload() (bool, error) {
+	info, err := os.Stat(f.path)
+	if err != nil {
+		return false, err
+	}
+	if info.ModTime().Equal(f.modTime) && info.Size() == f.size {
+		return false, nil
+	}
+	data, err := os.ReadFile(f.path)
+	if err != nil {
+		return false, err
+	}
+	if err = f.load(data); err != nil {
+		return false, err
+	}
+	f.modTime = info.ModTime()
+	f.size = info.Size()
+	return true, nil
+}
+
+// watch checks the file until the context is cancelled
+func (f *reloadableFile) watch(ctx context.Context) {
+	if f.interval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(f.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if loaded, err := f.reload(); err != nil {
+				// The error does not include the content, which could be secret
+				f.logger.Warn("Cannot reload file, keeping the previous content",
+					zap.String("file", f.path), zap.Error(err))
+			} else if loaded {
+				f.logger.Info("File reloaded", zap.String("file", f.path))
+			}
+		}
+	}
+}
@@ -0,0 +1,149 @@
+package contextprocessor
+
+import (
+	"fmt"
+)
+
+// ruleName returns the name of the rule for the errors
+func ruleName(i int, rule RuleConfig) string {
+	if rule.Name != "" {
+		return fmt.Sprintf("%q", rule.Name)
+	}
+	return fmt.Sprintf("#%d", i)
+}
+
+// subsumes returns true if every condition of m is also a condition of other,
+// so m always matches when other matches
+func (m MatchConfig) subsumes(other MatchConfig) bool {
+	for k, v := range m.Attributes {
+		if value, exists := other.Attributes[k]; !exists || value != v {
+			return false
+		}
+	}
+	for _, k := range m.Exists {
+		if _, exists := other.Attributes[k]; exists {
+			continue
+		}
+		found := false
+		for _, e := range other.Exists {
+			found = found || e == k
+		}
+		if !found {
+			return false
+		}
+	}
+	for k, v := range m.Metadata {
+		if value, exists := other.Metadata[k]; !exists || value != v {
+			return false
+		}
+	}
+	return true
+}
+
+func (m MatchConfig) isEmpty() bool {
+	return len(m.Attributes) == 0 && len(m.Exists) == 0 && len(m.Metadata) == 0
+}
+
+// validateRules checks the rules and reports the ones which can never match
+func validateRules(rules []RuleConfig) error {
+	for i, rule := range rules {
+		name := ruleName(i, rule)
+		if len(rule.ActionsConfig) == 0 {
+			return fmt.Errorf("rule %s: %w", name, errMissingRuleActions)
+		}
+		for _, action := range rule.ActionsConfig {
+			if err := action.Validate(); err != nil {
+				return fmt.Errorf("rule %s: %w", name, err)
+			}
+		}
+		if rule.Default {
+			if !rule.Match.isEmpty() {
+				return fmt.Errorf("default rule %s cannot have match conditions", name)
+			}
+			if i != len(rules)-1 {
+				return fmt.Errorf("rule %s can never match, it is after the default rule %s", ruleName(i+1, rules[i+1]), name)
+			}
+			continue
+		}
+		if rule.Match.isEmpty() {
+			return fmt.Errorf("rule %s without match conditions, use 'default: true'", name)
+		}
+		for j := 0; j < i; j++ {
+			if rules[j].Match.subsumes(rule.Match) {
+				return fmt.Errorf("rule %s can never match, rule %s matches first", name, ruleName(j, rules[j]))
+			}
+		}
+	}
+	return nil
+}
+
+// rule is a set of actions with the match conditions
+type rule struct {
+	match   MatchConfig
+	actions []Action
+}
+
+func (r *rule) matches(eventContext *eventContext) bool {
+	for k, v := range r.match.Attributes {
+		if value, exists := eventContext.getAttrKey(k, ""); !exists || value != v {
+			return false
+		}
+	}
+	for _, k := range r.match.Exists {
+		if _, exists := eventContext.getAttrKey(k, ""); !exists {
+			return false
+		}
+	}
+	for k, v := range r.match.Metadata {
+		values, _ := eventContext.getContextKey(k)
+		found := false
+		for _, value := range values {
+			found = found || value == v
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// ruleSet is an Action which applies the actions of the first matching rule
+type ruleSet struct {
+	rules []*rule
+}
+
+func newRuleSet(rules []RuleConfig) (*ruleSet, error) {
+	rs := &ruleSet{
+		rules: make([]*rule, 0, len(rules)),
+	}
+	for _, rc := range rules {
+		r := &rule{
+			match:   rc.Match,
+			actions: make([]Action, 0, len(rc.ActionsConfig)),
+		}
+		for _, action := range rc.ActionsConfig {
+			a, err := generateAction(action)
+			if err != nil {
+				return nil, err
+			}
+			r.actions = append(r.actions, a)
+		}
+		rs.rules = append(rs.rules, r)
+	}
+	return rs, nil
+}
+
+func (rs *ruleSet) execute(eventContext *eventContext) {
+	for _, r := range rs.rules {
+		if !r.matches(eventContext) {
+			continue
+		}
+		for _, a := range r.actions {
+			a.execute(eventContext)
+			if eventContext.err != nil {
+				return
+			}
+		}
+		return
+	}
+}
@@ -0,0 +1,180 @@
+package contextprocessor
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/collector/client"
+)
+
+// newTestRule returns a rule setting the team to the value
+func newTestRule(name string, match MatchConfig, value string) RuleConfig {
+	key := "x-team"
+	return RuleConfig{
+		Name:          name,
+		Match:         match,
+		ActionsConfig: []ActionConfig{{Key: &key, Action: UPSERT, ValueDefault: &value}},
+	}
+}
+
+func TestMatchConfigSubsumes(t *testing.T) {
+	tests := []struct {
+		name     string
+		m        MatchConfig
+		other    MatchConfig
+		expected bool
+	}{
+		{
+			name:     "same attributes",
+			m:        MatchConfig{Attributes: map[string]string{"env": "prod"}},
+			other:    MatchConfig{Attributes: map[string]string{"env": "prod", "region": "eu"}},
+			expected: true,
+		},
+		{
+			name:  "different value",
+			m:     MatchConfig{Attributes: map[string]string{"env": "prod"}},
+			other: MatchConfig{Attributes: map[string]string{"env": "dev"}},
+		},
+		{
+			name:  "more conditions",
+			m:     MatchConfig{Attributes: map[string]string{"env": "prod", "region": "eu"}},
+			other: MatchConfig{Attributes: map[string]string{"env": "prod"}},
+		},
+		{
+			// An attribute with a value also exists
+			name:     "exists and attribute",
+			m:        MatchConfig{Exists: []string{"env"}},
+			other:    MatchConfig{Attributes: map[string]string{"env": "prod"}},
+			expected: true,
+		},
+		{
+			name:     "exists",
+			m:        MatchConfig{Exists: []string{"env"}},
+			other:    MatchConfig{Exists: []string{"region", "env"}},
+			expected: true,
+		},
+		{
+			name:  "attribute and exists",
+			m:     MatchConfig{Attributes: map[string]string{"env": "prod"}},
+			other: MatchConfig{Exists: []string{"env"}},
+		},
+		{
+			name:     "metadata",
+			m:        MatchConfig{Metadata: map[string]string{"x-team": "shop"}},
+			other:    MatchConfig{Metadata: map[string]string{"x-team": "shop"}, Exists: []string{"env"}},
+			expected: true,
+		},
+		{
+			// The metadata and the attributes are different sources
+			name:  "metadata and attribute",
+			m:     MatchConfig{Metadata: map[string]string{"env": "prod"}},
+			other: MatchConfig{Attributes: map[string]string{"env": "prod"}},
+		},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.expected, tt.m.subsumes(tt.other), tt.name)
+	}
+}
+
+func TestValidateRules(t *testing.T) {
+	prod := MatchConfig{Attributes: map[string]string{"env": "prod"}}
+	prodEU := MatchConfig{Attributes: map[string]string{"env": "prod", "region": "eu"}}
+	defaultRule := newTestRule("other", MatchConfig{}, "other")
+	defaultRule.Default = true
+
+	tests := []struct {
+		name  string
+		rules []RuleConfig
+		err   string
+	}{
+		{
+			name:  "specific first",
+			rules: []RuleConfig{newTestRule("eu", prodEU, "a"), newTestRule("prod", prod, "b"), defaultRule},
+		},
+		{
+			name:  "never matches",
+			rules: []RuleConfig{newTestRule("prod", prod, "a"), newTestRule("eu", prodEU, "b")},
+			err:   `rule "eu" can never match, rule "prod" matches first`,
+		},
+		{
+			name:  "unnamed",
+			rules: []RuleConfig{newTestRule("", prod, "a"), newTestRule("", prod, "b")},
+			err:   "rule #1 can never match, rule #0 matches first",
+		},
+		{
+			name:  "after the default rule",
+			rules: []RuleConfig{defaultRule, newTestRule("prod", prod, "a")},
+			err:   `rule "prod" can never match, it is after the default rule "other"`,
+		},
+		{
+			name:  "without conditions",
+			rules: []RuleConfig{newTestRule("prod", MatchConfig{}, "a")},
+			err:   `rule "prod" without match conditions, use 'default: true'`,
+		},
+		{
+			name: "default with conditions",
+			rules: []RuleConfig{func() RuleConfig {
+				r := newTestRule("prod", prod, "a")
+				r.Default = true
+				return r
+			}()},
+			err: `default rule "prod" cannot have match conditions`,
+		},
+		{
+			name:  "without actions",
+			rules: []RuleConfig{{Name: "prod", Match: prod}},
+			err:   errMissingRuleActions.Error(),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateRules(tt.rules)
+			if tt.err == "" {
+				assert.NoError(t, err)
+				return
+			}
+			assert.ErrorContains(t, err, tt.err)
+		})
+	}
+}
+
+func TestRuleSetFirstMatch(t *testing.T) {
+	defaultRule := newTestRule("other", MatchConfig{}, "other")
+	defaultRule.Default = true
+	rules := []RuleConfig{
+		newTestRule("eu", MatchConfig{Attributes: map[string]string{"env": "prod", "region": "eu"}}, "eu"),
+		newTestRule("prod", MatchConfig{Attributes: map[string]string{"env": "prod"}}, "prod"),
+		newTestRule("shop", MatchConfig{Metadata: map[string]string{"x-org": "shop"}}, "shop"),
+		newTestRule("tenant", MatchConfig{Exists: []string{"tenant"}}, "tenant"),
+		defaultRule,
+	}
+	require.NoError(t, validateRules(rules))
+	rs, err := newRuleSet(rules)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name     string
+		attrs    map[string]any
+		metadata map[string][]string
+		expected string
+	}{
+		{name: "most specific", attrs: map[string]any{"env": "prod", "region": "eu", "tenant": "a"}, expected: "eu"},
+		{name: "second rule", attrs: map[string]any{"env": "prod", "region": "us"}, expected: "prod"},
+		{name: "metadata", attrs: map[string]any{"env": "dev", "tenant": "a"}, metadata: map[string][]string{"x-org": {"web", "shop"}}, expected: "shop"},
+		{name: "exists", attrs: map[string]any{"env": "dev", "tenant": "a"}, expected: "tenant"},
+		{name: "default", attrs: map[string]any{"env": "dev"}, metadata: map[string][]string{"x-org": {"web"}}, expected: "other"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := client.NewContext(context.Background(), client.Info{Metadata: client.NewMetadata(tt.metadata)})
+			eventContext := createEventContext(ctx, newTestAttributes(tt.attrs))
+			rs.execute(eventContext)
+			require.NoError(t, eventContext.err)
+			values, _ := eventContext.getContextKey("x-team")
+			// Only the actions of the first matching rule are applied
+			assert.Equal(t, []string{tt.expected}, values)
+		})
+	}
+}
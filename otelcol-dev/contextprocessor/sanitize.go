@@ -0,0 +1,124 @@
+package contextprocessor
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"go.opentelemetry.io/collector/consumer/consumererror"
+)
+
+const (
+	// Mimir, Loki, Tempo and Cortex share the same tenant ID validation (dskit)
+	maxTenantIDLength = 150
+	// Used to replace unsupported characters when normalizing
+	tenantIDReplacement = '_'
+)
+
+var (
+	errTenantIDEmpty       = errors.New("tenant ID is empty")
+	errTenantIDTooLong     = fmt.Errorf("tenant ID is longer than %d bytes", maxTenantIDLength)
+	errTenantIDUnsafe      = errors.New("tenant ID cannot be '.' or '..'")
+	errTenantIDReserved    = errors.New("tenant ID is reserved")
+	errTenantIDUnsupported = errors.New("tenant ID contains unsupported characters")
+)
+
+// tenantIDRules are the restrictions of a backend on the tenant IDs
+type tenantIDRules struct {
+	maxLength int
+	reserved  []string
+}
+
+// https://grafana.com/docs/mimir/latest/configure/about-tenant-ids/
+// https://grafana.com/docs/loki/latest/operations/multi-tenancy/
+// https://cortexmetrics.io/docs/guides/limitations/#tenant-id-naming
+var tenantIDPresets = map[SanitizePreset]tenantIDRules{
+	SANITIZE_MIMIR: {
+		maxLength: maxTenantIDLength,
+		reserved:  []string{"__mimir_cluster"},
+	},
+	SANITIZE_LOKI: {
+		maxLength: maxTenantIDLength,
+	},
+	SANITIZE_TEMPO: {
+		maxLength: maxTenantIDLength,
+	},
+	SANITIZE_CORTEX: {
+		maxLength: maxTenantIDLength,
+	},
+}
+
+// Supported characters: alphanumerics and !-_.*'()
+func isTenantIDChar(c rune) bool {
+	switch {
+	case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		return true
+	case c == '!', c == '-', c == '_', c == '.', c == '*', c == '\'', c == '(', c == ')':
+		return true
+	}
+	return false
+}
+
+// sanitizer checks the values against the tenant ID rules of a backend
+type sanitizer struct {
+	preset SanitizePreset
+	rules  tenantIDRules
+	mode   SanitizeMode
+}
+
+func newSanitizer(preset SanitizePreset, mode SanitizeMode) *sanitizer {
+	if mode == "" {
+		mode = SANITIZE_NORMALIZE
+	}
+	return &sanitizer{
+		preset: preset,
+		rules:  tenantIDPresets[preset],
+		mode:   mode,
+	}
+}
+
+// check returns an error if the value is not a valid tenant ID
+func (s *sanitizer) check(value string) error {
+	switch {
+	case value == "":
+		return errTenantIDEmpty
+	case len(value) > s.rules.maxLength:
+		return errTenantIDTooLong
+	case value == "." || value == "..":
+		return errTenantIDUnsafe
+	case strings.IndexFunc(value, func(c rune) bool { return !isTenantIDChar(c) }) >= 0:
+		return errTenantIDUnsupported
+	}
+	for _, reserved := range s.rules.reserved {
+		if value == reserved {
+			return errTenantIDReserved
+		}
+	}
+	return nil
+}
+
+// normalize replaces the unsupported characters and truncates the value
+func (s *sanitizer) normalize(value string) string {
+	value = strings.Map(func(c rune) rune {
+		if isTenantIDChar(c) {
+			return c
+		}
+		return tenantIDReplacement
+	}, value)
+	// Only ASCII characters remain, so bytes are characters
+	if len(value) > s.rules.maxLength {
+		value = value[:s.rules.maxLength]
+	}
+	return value
+}
+
+// sanitize returns the value to use or a permanent error if it cannot be used
+func (s *sanitizer) sanitize(value string) (string, error) {
+	if s.mode == SANITIZE_NORMALIZE {
+		value = s.normalize(value)
+	}
+	if err := s.check(value); err != nil {
+		return value, consumererror.NewPermanent(fmt.Errorf("invalid %s tenant ID %q: %w", s.preset, value, err))
+	}
+	return value, nil
+}
@@ -0,0 +1,95 @@
+package contextprocessor
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/collector/consumer/consumererror"
+)
+
+// Rules published for Mimir, Loki, Tempo and Cortex tenant IDs
+func TestSanitizeCheck(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+		err   error
+	}{
+		{name: "alphanumerics", value: "Tenant01", err: nil},
+		{name: "special characters", value: "team-a_b.c!*'()", err: nil},
+		{name: "max length", value: strings.Repeat("a", 150), err: nil},
+		{name: "too long", value: strings.Repeat("a", 151), err: errTenantIDTooLong},
+		{name: "empty", value: "", err: errTenantIDEmpty},
+		{name: "dot", value: ".", err: errTenantIDUnsafe},
+		{name: "dot dot", value: "..", err: errTenantIDUnsafe},
+		{name: "dots inside", value: "a..b", err: nil},
+		{name: "slash", value: "team/a", err: errTenantIDUnsupported},
+		{name: "space", value: "team a", err: errTenantIDUnsupported},
+		{name: "pipe", value: "team-a|team-b", err: errTenantIDUnsupported},
+		{name: "colon", value: "team:a", err: errTenantIDUnsupported},
+		{name: "non ascii", value: "équipe", err: errTenantIDUnsupported},
+	}
+	for _, preset := range []SanitizePreset{SANITIZE_MIMIR, SANITIZE_LOKI, SANITIZE_TEMPO, SANITIZE_CORTEX} {
+		s := newSanitizer(preset, SANITIZE_REJECT)
+		for _, tt := range tests {
+			t.Run(string(preset)+"/"+tt.name, func(t *testing.T) {
+				err := s.check(tt.value)
+				if tt.err == nil {
+					assert.NoError(t, err)
+				} else {
+					assert.ErrorIs(t, err, tt.err)
+				}
+			})
+		}
+	}
+}
+
+func TestSanitizeMimirReserved(t *testing.T) {
+	assert.ErrorIs(t, newSanitizer(SANITIZE_MIMIR, SANITIZE_REJECT).check("__mimir_cluster"), errTenantIDReserved)
+	assert.NoError(t, newSanitizer(SANITIZE_LOKI, SANITIZE_REJECT).check("__mimir_cluster"))
+}
+
+func TestSanitizeNormalize(t *testing.T) {
+	tests := []struct {
+		name     string
+		value    string
+		expected string
+		valid    bool
+	}{
+		{name: "valid", value: "team-a", expected: "team-a", valid: true},
+		{name: "slash", value: "platform/team-a", expected: "platform_team-a", valid: true},
+		{name: "spaces", value: "my service", expected: "my_service", valid: true},
+		{name: "non ascii", value: "équipe", expected: "_quipe", valid: true},
+		{name: "truncate", value: strings.Repeat("b", 200), expected: strings.Repeat("b", 150), valid: true},
+		{name: "truncate after replace", value: strings.Repeat("é", 200), expected: strings.Repeat("_", 150), valid: true},
+		{name: "empty", value: "", expected: "", valid: false},
+		{name: "dot", value: ".", expected: ".", valid: false},
+		{name: "dot dot", value: "..", expected: "..", valid: false},
+	}
+	s := newSanitizer(SANITIZE_MIMIR, "")
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			value, err := s.sanitize(tt.value)
+			assert.Equal(t, tt.expected, value)
+			if tt.valid {
+				assert.NoError(t, err)
+			} else {
+				require.Error(t, err)
+				assert.True(t, consumererror.IsPermanent(err))
+			}
+		})
+	}
+}
+
+func TestSanitizeReject(t *testing.T) {
+	s := newSanitizer(SANITIZE_LOKI, SANITIZE_REJECT)
+	value, err := s.sanitize("team-a")
+	require.NoError(t, err)
+	assert.Equal(t, "team-a", value)
+
+	_, err = s.sanitize("platform/team-a")
+	require.Error(t, err)
+	assert.True(t, consumererror.IsPermanent(err))
+	assert.ErrorIs(t, err, errTenantIDUnsupported)
+}
@@ -0,0 +1,159 @@
+package contextprocessor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.opentelemetry.io/collector/client"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.uber.org/zap"
+)
+
+const (
+	// Maximum number of timed out calls still running, past it the calls
+	// wait for the next consumer
+	maxAbandonedCalls = 100
+	// Number of tenants used as label of the metric
+	maxTimeoutLabels = 1000
+)
+
+// States of a call to the next consumer
+const (
+	callRunning int32 = iota
+	callFinished
+	callAbandoned
+)
+
+// callTimeout limits the duration of the calls to the next consumer
+type callTimeout struct {
+	logger  *zap.Logger
+	timeout time.Duration
+	// key is the metadata key with the tenant, the label of the metric
+	key string
+	// labels are the tenants used as label of the metric, up to maxCardinality
+	maxCardinality int
+	mu             sync.Mutex
+	labels         map[string]struct{}
+	processor      attribute.KeyValue
+	signal         attribute.KeyValue
+	timeouts       metric.Int64Counter
+	// abandoned are the timed out calls still running
+	abandoned      atomic.Int64
+	abandonedCalls metric.Int64UpDownCounter
+}
+
+func newCallTimeout(
+	logger *zap.Logger,
+	meter metric.Meter,
+	processor attribute.KeyValue,
+	signal string,
+	timeout time.Duration,
+	key string) (*callTimeout, error) {
+
+	timeouts, err := meter.Int64Counter(
+		"processor_context_timeouts",
+		metric.WithDescription("Number of calls to the next consumer which exceeded the timeout, by tenant"),
+		metric.WithUnit("{calls}"),
+	)
+	if err != nil {
+		return nil, err
+	}
+	abandonedCalls, err := meter.Int64UpDownCounter(
+		"processor_context_timeouts_abandoned",
+		metric.WithDescription("Number of calls to the next consumer which timed out and are still running"),
+		metric.WithUnit("{calls}"),
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &callTimeout{
+		logger:         logger,
+		timeout:        timeout,
+		key:            key,
+		maxCardinality: maxTimeoutLabels,
+		labels:         make(map[string]struct{}),
+		processor:      processor,
+		signal:         attribute.String("signal", signal),
+		timeouts:       timeouts,
+		abandonedCalls: abandonedCalls,
+	}, nil
+}
+
+// call calls next with a deadline. When it is exceeded a retryable error is
+// returned without waiting for next, which owns the data and may still send
+// it. With too many of those calls still running, next is waited for. Without
+// timeout next is just called.
+func (t *callTimeout) call(ctx context.Context, next func(context.Context) error) error {
+	if t == nil {
+		return next(ctx)
+	}
+	callCtx, cancel := context.WithTimeout(ctx, t.timeout)
+	defer cancel()
+	if t.abandoned.Load() >= maxAbandonedCalls {
+		err := next(callCtx)
+		if err != nil && ctx.Err() == nil && errors.Is(callCtx.Err(), context.DeadlineExceeded) {
+			return t.timedOut(ctx)
+		}
+		return err
+	}
+	var state atomic.Int32
+	done := make(chan error, 1)
+	go func() {
+		done <- next(callCtx)
+		if !state.CompareAndSwap(callRunning, callFinished) {
+			t.abandoned.Add(-1)
+			t.abandonedCalls.Add(context.Background(), -1, metric.WithAttributes(t.processor, t.signal))
+		}
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-callCtx.Done():
+	}
+	if !state.CompareAndSwap(callRunning, callAbandoned) {
+		// It finished in the meantime
+		return <-done
+	}
+	t.abandoned.Add(1)
+	t.abandonedCalls.Add(ctx, 1, metric.WithAttributes(t.processor, t.signal))
+	// The caller cancelled, it is not a timeout of the next consumer
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return t.timedOut(ctx)
+}
+
+// timedOut counts the timeout by tenant and returns a retryable error
+func (t *callTimeout) timedOut(ctx context.Context) error {
+	attrs := []attribute.KeyValue{t.processor, t.signal}
+	if t.key != "" {
+		tenant := strings.Join(client.FromContext(ctx).Metadata.Get(t.key), ",")
+		attrs = append(attrs, attribute.String(t.key, t.label(tenant)))
+		t.logger.Debug("Next consumer timed out", zap.String(t.key, tenant), zap.Duration("timeout", t.timeout))
+	} else {
+		t.logger.Debug("Next consumer timed out", zap.Duration("timeout", t.timeout))
+	}
+	t.timeouts.Add(ctx, 1, metric.WithAttributes(attrs...))
+	return fmt.Errorf("next consumer timed out after %s: %w", t.timeout, context.DeadlineExceeded)
+}
+
+// label returns the tenant as label of the metric, or the overflow value when
+// there are too many different ones
+func (t *callTimeout) label(tenant string) string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if _, exists := t.labels[tenant]; exists {
+		return tenant
+	}
+	if len(t.labels) >= t.maxCardinality {
+		return defaultOverflowValue
+	}
+	t.labels[tenant] = struct{}{}
+	return tenant
+}
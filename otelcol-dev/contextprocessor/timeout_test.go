@@ -0,0 +1,102 @@
+package contextprocessor
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/collector/client"
+	"go.opentelemetry.io/otel/attribute"
+	"go.uber.org/zap"
+)
+
+func TestCallTimeout(t *testing.T) {
+	meter, reader := newTestMetricReader()
+	timeout, err := newCallTimeout(zap.NewNop(), meter, newTestProcessorID(), "log_records", 10*time.Millisecond, "x-scope-orgid")
+	require.NoError(t, err)
+	ctx := client.NewContext(context.Background(), client.Info{
+		Metadata: client.NewMetadata(map[string][]string{"x-scope-orgid": {"team-a"}}),
+	})
+
+	require.NoError(t, timeout.call(ctx, func(context.Context) error { return nil }))
+	assert.Nil(t, collectSum(t, reader, "processor_context_timeouts"))
+
+	release := make(chan struct{})
+	err = timeout.call(ctx, func(context.Context) error {
+		<-release
+		return nil
+	})
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	points := collectSum(t, reader, "processor_context_timeouts")
+	require.Len(t, points, 1)
+	assert.Equal(t, int64(1), points[0].Value)
+	tenant, _ := points[0].Attributes.Value(attribute.Key("x-scope-orgid"))
+	assert.Equal(t, "team-a", tenant.AsString())
+	signal, _ := points[0].Attributes.Value(attribute.Key("signal"))
+	assert.Equal(t, "log_records", signal.AsString())
+
+	// The abandoned call is counted until it returns
+	points = collectSum(t, reader, "processor_context_timeouts_abandoned")
+	require.Len(t, points, 1)
+	assert.Equal(t, int64(1), points[0].Value)
+	close(release)
+	assert.Eventually(t, func() bool { return timeout.abandoned.Load() == 0 }, time.Second, time.Millisecond)
+	assert.Equal(t, int64(0), collectSum(t, reader, "processor_context_timeouts_abandoned")[0].Value)
+}
+
+func TestCallTimeoutCancelled(t *testing.T) {
+	meter, reader := newTestMetricReader()
+	timeout, err := newCallTimeout(zap.NewNop(), meter, newTestProcessorID(), "spans", time.Hour, "")
+	require.NoError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	err = timeout.call(ctx, func(callCtx context.Context) error {
+		cancel()
+		<-callCtx.Done()
+		// Returned after the caller sees the cancellation
+		time.Sleep(10 * time.Millisecond)
+		return errors.New("cancelled")
+	})
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Nil(t, collectSum(t, reader, "processor_context_timeouts"))
+}
+
+func TestCallTimeoutMaxAbandoned(t *testing.T) {
+	timeout, err := newCallTimeout(zap.NewNop(), newTestMeter(), newTestProcessorID(), "metrics", time.Millisecond, "")
+	require.NoError(t, err)
+	timeout.abandoned.Store(maxAbandonedCalls)
+	// The call is waited for, its result is the timeout
+	returned := false
+	err = timeout.call(context.Background(), func(callCtx context.Context) error {
+		<-callCtx.Done()
+		returned = true
+		return callCtx.Err()
+	})
+	assert.True(t, returned)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Equal(t, int64(maxAbandonedCalls), timeout.abandoned.Load())
+}
+
+func TestCallTimeoutLabelOverflow(t *testing.T) {
+	meter, reader := newTestMetricReader()
+	timeout, err := newCallTimeout(zap.NewNop(), meter, newTestProcessorID(), "log_records", time.Hour, "x-scope-orgid")
+	require.NoError(t, err)
+	assert.Equal(t, maxTimeoutLabels, timeout.maxCardinality)
+	timeout.maxCardinality = 2
+
+	for _, tenant := range []string{"team-a", "team-b", "team-c", "team-a", "team-d"} {
+		ctx := client.NewContext(context.Background(), client.Info{
+			Metadata: client.NewMetadata(map[string][]string{"x-scope-orgid": {tenant}}),
+		})
+		assert.ErrorIs(t, timeout.timedOut(ctx), context.DeadlineExceeded)
+	}
+	counts := make(map[string]int64)
+	for _, point := range collectSum(t, reader, "processor_context_timeouts") {
+		tenant, _ := point.Attributes.Value(attribute.Key("x-scope-orgid"))
+		counts[tenant.AsString()] = point.Value
+	}
+	// The tenants seen first keep their label
+	assert.Equal(t, map[string]int64{"team-a": 2, "team-b": 1, defaultOverflowValue: 2}, counts)
+}
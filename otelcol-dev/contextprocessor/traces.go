@@ -2,9 +2,14 @@ package contextprocessor
 
 import (
 	"context"
+	"errors"
+	"time"
 
 	"go.opentelemetry.io/collector/consumer"
+	"go.opentelemetry.io/collector/pdata/pcommon"
 	"go.opentelemetry.io/collector/pdata/ptrace"
+	"go.opentelemetry.io/collector/processor"
+	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/trace"
 	"go.uber.org/zap"
 )
@@ -12,27 +17,46 @@ import (
 type contextTracesProcessor struct {
 	contextProcessor
 	nextConsumer consumer.Traces
+	sizer        ptrace.MarshalSizer
+	// traceTenants keeps the same value of a key for all the spans of a trace
+	traceTenants *traceTenants
 }
 
 func NewContextTracesProcessor(
-	logger *zap.Logger,
+	set processor.Settings,
 	nextConsumer consumer.Traces,
 	eventOptions trace.SpanStartEventOption,
-	actions []ActionConfig) (*contextTracesProcessor, error) {
-	aRunner := NewActionsRunner()
-	for _, action := range actions {
-		if err := aRunner.AddAction(action); err != nil {
+	cfg *Config) (*contextTracesProcessor, error) {
+	ctxt, err := newContextProcessor(set, eventOptions, cfg, "spans")
+	if err != nil {
+		return nil, err
+	}
+	ctxtp := &contextTracesProcessor{
+		contextProcessor: *ctxt,
+		nextConsumer:     nextConsumer,
+		sizer:            &ptrace.ProtoMarshaler{},
+	}
+	if cfg.TraceConsistency != nil {
+		meter := set.MeterProvider.Meter(scopeName)
+		id := attribute.String("processor", set.ID.String())
+		if ctxtp.traceTenants, err = newTraceTenants(meter, id, cfg.TraceConsistency); err != nil {
 			return nil, err
 		}
+		ctxtp.background = append(ctxtp.background, func(ctx context.Context) {
+			ctxtp.traceTenants.run(ctx, ctxtp.release)
+		})
 	}
-	return &contextTracesProcessor{
-		contextProcessor: contextProcessor{
-			logger:        logger,
-			actionsRunner: aRunner,
-			eventOptions:  eventOptions,
-		},
-		nextConsumer: nextConsumer,
-	}, nil
+	return ctxtp, nil
+}
+
+// implements https://pkg.go.dev/go.opentelemetry.io/collector/component#Component  Shutdown
+func (ctxt *contextTracesProcessor) Shutdown(ctx context.Context) error {
+	if ctxt.traceTenants != nil {
+		for _, r := range ctxt.traceTenants.due(time.Now(), true) {
+			ctxt.release(r)
+		}
+	}
+	return ctxt.contextProcessor.Shutdown(ctx)
 }
 
 // implements https://pkg.go.dev/go.opentelemetry.io/collector/consumer#Traces
@@ -40,15 +64,240 @@ func (ctxt *contextTracesProcessor) ConsumeTraces(ctx context.Context, td ptrace
 
 	span := trace.SpanFromContext(ctx)
 	span.AddEvent("Start processing.", ctxt.eventOptions)
+	d := ctxt.newDispatcher()
 	rss := td.ResourceSpans()
 	for i := 0; i < rss.Len() && err == nil; i++ {
 		rt := rss.At(i)
-		attrs := rt.Resource().Attributes()
-		newCtx := ctxt.actionsRunner.Apply(ctx, attrs)
-		newTd := ptrace.NewTraces()
-		rt.CopyTo(newTd.ResourceSpans().AppendEmpty())
-		err = ctxt.nextConsumer.ConsumeTraces(newCtx, newTd)
+		var eventContext *eventContext
+		if eventContext, err = ctxt.actionsRunner.run(ctx, rt.Resource().Attributes(), sourceValues{schemaURL: rt.SchemaUrl()}); err != nil {
+			if errors.Is(err, errDataDropped) {
+				err = nil
+			}
+			continue
+		}
+		if ctxt.traceTenants != nil {
+			err = ctxt.consumeTraces(ctx, d, rt, eventContext)
+		} else {
+			err = ctxt.consumeResource(ctx, d, rt, eventContext)
+		}
 	}
+	err = d.wait(err)
 	span.AddEvent("End processing.", ctxt.eventOptions)
 	return err
 }
+
+// consumeResource forwards a copy of the resource for each context
+func (ctxt *contextTracesProcessor) consumeResource(
+	ctx context.Context,
+	d *dispatcher,
+	rt ptrace.ResourceSpans,
+	eventContext *eventContext) error {
+
+	copies, err := ctxt.actionsRunner.copies(eventContext)
+	if err != nil {
+		if errors.Is(err, errDataDropped) {
+			return nil
+		}
+		return err
+	}
+	copies = copies[:ctxt.fanOut.limit(ctx, len(copies))]
+	for j := 0; j < len(copies) && err == nil; j++ {
+		newTd := ptrace.NewTraces()
+		newR := newTd.ResourceSpans().AppendEmpty()
+		rt.CopyTo(newR)
+		copies[j].copyResourceTo(newR.Resource())
+		newCtx := copies[j].getContext()
+		for _, chunk := range ctxt.chunks(newTd) {
+			chunk := chunk
+			if err = d.send(func() error {
+				return ctxt.forward(newCtx, chunk)
+			}); err != nil {
+				break
+			}
+		}
+	}
+	return err
+}
+
+// consumeTraces splits the spans of the resource by the value of the key of
+// their trace. Spans waiting for the root span of their trace are held.
+func (ctxt *contextTracesProcessor) consumeTraces(
+	ctx context.Context,
+	d *dispatcher,
+	rt ptrace.ResourceSpans,
+	eventContext *eventContext) error {
+
+	key := ctxt.traceTenants.key
+	values, exists := eventContext.getContextKey(key)
+	// Resources without value, or sent to several values, are not changed
+	if !exists || len(values) != 1 {
+		return ctxt.consumeResource(ctx, d, rt, eventContext)
+	}
+	value := values[0]
+	roots := make(map[pcommon.TraceID]bool)
+	forEachSpan(rt, func(span ptrace.Span) {
+		roots[span.TraceID()] = roots[span.TraceID()] || span.ParentSpanID().IsEmpty()
+	})
+	now := time.Now()
+	decisions := make(map[pcommon.TraceID]string, len(roots))
+	held := make(map[pcommon.TraceID]bool)
+	changed := false
+	var released []release
+	for traceID, hasRoot := range roots {
+		decided, hold, r := ctxt.traceTenants.decide(traceID, value, hasRoot, now)
+		released = append(released, r...)
+		decisions[traceID] = decided
+		held[traceID] = hold
+		changed = changed || hold || decided != value
+	}
+	for _, r := range released {
+		ctxt.release(r)
+	}
+	if !changed {
+		return ctxt.consumeResource(ctx, d, rt, eventContext)
+	}
+	groups, order := splitSpans(rt, func(span ptrace.Span) string {
+		if held[span.TraceID()] {
+			return "held:" + span.TraceID().String()
+		}
+		return "value:" + decisions[span.TraceID()]
+	})
+	var err error
+	for _, group := range order {
+		td := groups[group]
+		newRt := td.ResourceSpans().At(0)
+		traceID := newRt.ScopeSpans().At(0).Spans().At(0).TraceID()
+		decided := decisions[traceID]
+		if held[traceID] {
+			spans := heldSpans{
+				value:        value,
+				eventContext: eventContext.withKey(context.Background(), newRt.Resource().Attributes(), key, value),
+				td:           td,
+			}
+			for _, r := range ctxt.traceTenants.hold(traceID, spans) {
+				ctxt.release(r)
+			}
+			continue
+		}
+		groupContext := eventContext
+		if decided != value {
+			groupContext = ctxt.actionsRunner.reassign(ctx, eventContext, newRt.Resource().Attributes(), key, decided)
+			ctxt.traceTenants.reassigned.Add(ctx, int64(td.SpanCount()), ctxt.traceTenants.attrs)
+		}
+		if err == nil {
+			err = ctxt.consumeResource(ctx, d, newRt, groupContext)
+		}
+	}
+	return err
+}
+
+// release sends the held spans with the decided value, errors are logged
+func (ctxt *contextTracesProcessor) release(r release) {
+	key := ctxt.traceTenants.key
+	ctx := context.Background()
+	d := ctxt.newDispatcher()
+	for _, held := range r.held {
+		rt := held.td.ResourceSpans().At(0)
+		eventContext := held.eventContext
+		if held.value != r.value {
+			eventContext = ctxt.actionsRunner.reassign(ctx, eventContext, rt.Resource().Attributes(), key, r.value)
+			ctxt.traceTenants.reassigned.Add(ctx, int64(held.td.SpanCount()), ctxt.traceTenants.attrs)
+		}
+		if err := ctxt.consumeResource(ctx, d, rt, eventContext); err != nil {
+			ctxt.logger.Warn("Cannot send the spans held waiting for the root span", zap.Error(err))
+		}
+	}
+	if err := d.wait(nil); err != nil {
+		ctxt.logger.Warn("Cannot send the spans held waiting for the root span", zap.Error(err))
+	}
+}
+
+// forEachSpan calls f with each span of the resource
+func forEachSpan(rt ptrace.ResourceSpans, f func(ptrace.Span)) {
+	sss := rt.ScopeSpans()
+	for i := 0; i < sss.Len(); i++ {
+		spans := sss.At(i).Spans()
+		for j := 0; j < spans.Len(); j++ {
+			f(spans.At(j))
+		}
+	}
+}
+
+// splitSpans returns a copy of the resource for each group of spans, and the
+// groups in order of appearance
+func splitSpans(rt ptrace.ResourceSpans, groupOf func(ptrace.Span) string) (map[string]ptrace.Traces, []string) {
+	groups := make(map[string]ptrace.Traces)
+	order := make([]string, 0, 1)
+	sss := rt.ScopeSpans()
+	for i := 0; i < sss.Len(); i++ {
+		ss := sss.At(i)
+		scopes := make(map[string]ptrace.ScopeSpans)
+		spans := ss.Spans()
+		for j := 0; j < spans.Len(); j++ {
+			span := spans.At(j)
+			group := groupOf(span)
+			td, exists := groups[group]
+			if !exists {
+				td = ptrace.NewTraces()
+				newRt := td.ResourceSpans().AppendEmpty()
+				rt.Resource().CopyTo(newRt.Resource())
+				newRt.SetSchemaUrl(rt.SchemaUrl())
+				groups[group] = td
+				order = append(order, group)
+			}
+			scope, exists := scopes[group]
+			if !exists {
+				scope = td.ResourceSpans().At(0).ScopeSpans().AppendEmpty()
+				ss.Scope().CopyTo(scope.Scope())
+				scope.SetSchemaUrl(ss.SchemaUrl())
+				scopes[group] = scope
+			}
+			span.CopyTo(scope.Spans().AppendEmpty())
+		}
+	}
+	return groups, order
+}
+
+// chunks splits the spans within max_items and max_bytes, in order
+func (ctxt *contextTracesProcessor) chunks(td ptrace.Traces) []ptrace.Traces {
+	if !ctxt.chunked() {
+		return []ptrace.Traces{td}
+	}
+	payloads := []ptrace.Traces{td}
+	order := ctxt.chunkOrder(
+		func(i int) int { return payloads[i].SpanCount() },
+		func(i int) int { return ctxt.sizer.TracesSize(payloads[i]) },
+		func(i, n int) int {
+			payloads = append(payloads, splitTraces(payloads[i], n))
+			return len(payloads) - 1
+		})
+	chunks := make([]ptrace.Traces, 0, len(order))
+	for _, i := range order {
+		chunks = append(chunks, payloads[i])
+	}
+	return chunks
+}
+
+// forward sends the data to the next consumer if it is not over the rate limit
+func (ctxt *contextTracesProcessor) forward(ctx context.Context, td ptrace.Traces) error {
+	// Sizes are taken before, the next consumer owns the data afterwards
+	items, size := td.SpanCount(), 0
+	if ctxt.limiter != nil {
+		if err := ctxt.limiter.acquire(ctx, items); err != nil {
+			if errors.Is(err, errDataDropped) {
+				return nil
+			}
+			return err
+		}
+	}
+	if ctxt.usage != nil {
+		size = ctxt.sizer.TracesSize(td)
+	}
+	err := ctxt.timeout.call(ctx, func(ctx context.Context) error {
+		return ctxt.nextConsumer.ConsumeTraces(ctx, td)
+	})
+	if err == nil && ctxt.usage != nil {
+		ctxt.usage.record(ctx, items, size)
+	}
+	return err
+}
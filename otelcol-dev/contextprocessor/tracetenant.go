@@ -0,0 +1,236 @@
+package contextprocessor
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/collector/pdata/pcommon"
+	"go.opentelemetry.io/collector/pdata/ptrace"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+const (
+	defaultMaxTraces = 100000
+	defaultTraceTTL  = 5 * time.Minute
+	// Minimum period between two checks of the held spans
+	minDecisionTick = 10 * time.Millisecond
+)
+
+// heldSpans are spans of a resource waiting for the root span of their trace
+type heldSpans struct {
+	// value is the one of the resource
+	value        string
+	eventContext *eventContext
+	td           ptrace.Traces
+}
+
+// traceEntry is the value of the key decided for a trace
+type traceEntry struct {
+	traceID  pcommon.TraceID
+	value    string
+	root     bool
+	lastSeen time.Time
+	// deadline is the end of the decision wait of the held spans
+	deadline time.Time
+	held     []heldSpans
+	elem     *list.Element
+}
+
+// release is a set of held spans to send with the decided value
+type release struct {
+	value string
+	held  []heldSpans
+}
+
+// traceTenants remembers the value of the key of each trace in a LRU cache,
+// the least recently seen traces are evicted first
+type traceTenants struct {
+	key       string
+	mode      TraceMode
+	maxTraces int
+	ttl       time.Duration
+	wait      time.Duration
+	mutex     sync.Mutex
+	traces    map[pcommon.TraceID]*traceEntry
+	// lru has the entries, the most recently seen first
+	lru *list.List
+	// waiting are the entries with held spans
+	waiting    map[pcommon.TraceID]*traceEntry
+	attrs      metric.MeasurementOption
+	reassigned metric.Int64Counter
+	heldSpans  metric.Int64Counter
+}
+
+func newTraceTenants(
+	meter metric.Meter,
+	processor attribute.KeyValue,
+	cfg *TraceConsistencyConfig) (*traceTenants, error) {
+
+	reassigned, err := meter.Int64Counter(
+		"processor_context_trace_reassigned",
+		metric.WithDescription("Number of spans sent with the value of the key of their trace instead of the one of their resource"),
+		metric.WithUnit("{spans}"),
+	)
+	if err != nil {
+		return nil, err
+	}
+	heldSpans, err := meter.Int64Counter(
+		"processor_context_trace_held",
+		metric.WithDescription("Number of spans held waiting for the root span of their trace"),
+		metric.WithUnit("{spans}"),
+	)
+	if err != nil {
+		return nil, err
+	}
+	t := &traceTenants{
+		key:        cfg.MetadataKey,
+		mode:       cfg.Mode,
+		maxTraces:  cfg.MaxTraces,
+		ttl:        cfg.TTL,
+		wait:       cfg.DecisionWait,
+		traces:     make(map[pcommon.TraceID]*traceEntry),
+		lru:        list.New(),
+		waiting:    make(map[pcommon.TraceID]*traceEntry),
+		attrs:      metric.WithAttributes(processor),
+		reassigned: reassigned,
+		heldSpans:  heldSpans,
+	}
+	if t.mode == "" {
+		t.mode = TRACE_ROOT
+	}
+	if t.maxTraces == 0 {
+		t.maxTraces = defaultMaxTraces
+	}
+	if t.ttl == 0 {
+		t.ttl = defaultTraceTTL
+	}
+	return t, nil
+}
+
+// decide returns the value of the key for a trace of a resource with the
+// given value, or hold true if the spans have to wait for the root span.
+// Spans released by this decision (or by evictions) are returned.
+func (t *traceTenants) decide(traceID pcommon.TraceID, value string, hasRoot bool, now time.Time) (string, bool, []release) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	released := t.expire(now)
+	entry, exists := t.traces[traceID]
+	if !exists {
+		entry = &traceEntry{
+			traceID: traceID,
+			value:   value,
+			root:    hasRoot,
+		}
+		entry.elem = t.lru.PushFront(entry)
+		t.traces[traceID] = entry
+		if t.lru.Len() > t.maxTraces {
+			released = append(released, t.evict(t.lru.Back().Value.(*traceEntry))...)
+		}
+	} else {
+		t.lru.MoveToFront(entry.elem)
+	}
+	entry.lastSeen = now
+	if t.mode == TRACE_FIRST_SEEN {
+		return entry.value, false, released
+	}
+	if hasRoot && !entry.root {
+		entry.value = value
+		entry.root = true
+	}
+	if entry.root || t.wait <= 0 {
+		if len(entry.held) > 0 {
+			released = append(released, release{value: entry.value, held: entry.held})
+			entry.held = nil
+			delete(t.waiting, traceID)
+		}
+		return entry.value, false, released
+	}
+	if entry.deadline.IsZero() {
+		entry.deadline = now.Add(t.wait)
+	}
+	if now.Before(entry.deadline) {
+		return entry.value, true, released
+	}
+	return entry.value, false, released
+}
+
+// hold keeps spans until the root span arrives or the decision wait ends
+func (t *traceTenants) hold(traceID pcommon.TraceID, held heldSpans) []release {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	entry, exists := t.traces[traceID]
+	if !exists {
+		// Evicted in the meantime
+		return []release{{value: held.value, held: []heldSpans{held}}}
+	}
+	entry.held = append(entry.held, held)
+	t.waiting[traceID] = entry
+	t.heldSpans.Add(context.Background(), int64(held.td.SpanCount()), t.attrs)
+	return nil
+}
+
+// expire removes the traces not seen during the TTL, the lru is ordered by
+// last seen
+func (t *traceTenants) expire(now time.Time) []release {
+	var released []release
+	for e := t.lru.Back(); e != nil; e = t.lru.Back() {
+		entry := e.Value.(*traceEntry)
+		if now.Sub(entry.lastSeen) < t.ttl {
+			break
+		}
+		released = append(released, t.evict(entry)...)
+	}
+	return released
+}
+
+func (t *traceTenants) evict(entry *traceEntry) []release {
+	t.lru.Remove(entry.elem)
+	delete(t.traces, entry.traceID)
+	delete(t.waiting, entry.traceID)
+	if len(entry.held) == 0 {
+		return nil
+	}
+	return []release{{value: entry.value, held: entry.held}}
+}
+
+// due returns the held spans whose decision wait ended, or all of them
+func (t *traceTenants) due(now time.Time, all bool) []release {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	var released []release
+	for traceID, entry := range t.waiting {
+		if all || !now.Before(entry.deadline) {
+			released = append(released, release{value: entry.value, held: entry.held})
+			entry.held = nil
+			delete(t.waiting, traceID)
+		}
+	}
+	return released
+}
+
+// run sends the held spans when their decision wait ends, until the context
+// is cancelled
+func (t *traceTenants) run(ctx context.Context, send func(release)) {
+	if t.wait <= 0 {
+		return
+	}
+	tick := t.wait / 2
+	if tick < minDecisionTick {
+		tick = minDecisionTick
+	}
+	ticker := time.NewTicker(tick)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			for _, r := range t.due(now, false) {
+				send(r)
+			}
+		}
+	}
+}
@@ -0,0 +1,257 @@
+package contextprocessor
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/collector/client"
+	"go.opentelemetry.io/collector/component/componenttest"
+	"go.opentelemetry.io/collector/consumer"
+	"go.opentelemetry.io/collector/consumer/consumertest"
+	"go.opentelemetry.io/collector/pdata/pcommon"
+	"go.opentelemetry.io/collector/pdata/ptrace"
+	"go.opentelemetry.io/collector/processor/processortest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func newTestTraceTenants(t *testing.T, cfg *TraceConsistencyConfig) *traceTenants {
+	cfg.MetadataKey = "x-scope-orgid"
+	tenants, err := newTraceTenants(newTestMeter(), newTestProcessorID(), cfg)
+	require.NoError(t, err)
+	return tenants
+}
+
+// newTestHeld returns a span of the trace held with the value
+func newTestHeld(traceID pcommon.TraceID, value string) heldSpans {
+	td := ptrace.NewTraces()
+	td.ResourceSpans().AppendEmpty().ScopeSpans().AppendEmpty().Spans().AppendEmpty().SetTraceID(traceID)
+	return heldSpans{value: value, eventContext: newEventContext(), td: td}
+}
+
+func TestTraceTenantsDecide(t *testing.T) {
+	traceID := pcommon.TraceID([16]byte{1})
+	now := time.Now()
+
+	tenants := newTestTraceTenants(t, &TraceConsistencyConfig{})
+	value, hold, released := tenants.decide(traceID, "a", false, now)
+	assert.Equal(t, "a", value)
+	assert.False(t, hold)
+	assert.Empty(t, released)
+	// The root span decides the value
+	value, _, _ = tenants.decide(traceID, "b", true, now)
+	assert.Equal(t, "b", value)
+	value, _, _ = tenants.decide(traceID, "c", false, now)
+	assert.Equal(t, "b", value)
+
+	tenants = newTestTraceTenants(t, &TraceConsistencyConfig{Mode: TRACE_FIRST_SEEN})
+	tenants.decide(traceID, "a", false, now)
+	value, hold, _ = tenants.decide(traceID, "b", true, now)
+	assert.Equal(t, "a", value)
+	assert.False(t, hold)
+}
+
+func TestTraceTenantsHold(t *testing.T) {
+	traceID := pcommon.TraceID([16]byte{1})
+	now := time.Now()
+	tenants := newTestTraceTenants(t, &TraceConsistencyConfig{DecisionWait: time.Minute})
+
+	value, hold, _ := tenants.decide(traceID, "a", false, now)
+	assert.Equal(t, "a", value)
+	assert.True(t, hold)
+	assert.Empty(t, tenants.hold(traceID, newTestHeld(traceID, "a")))
+	// Released with the value of the root span
+	value, hold, released := tenants.decide(traceID, "b", true, now.Add(time.Second))
+	assert.Equal(t, "b", value)
+	assert.False(t, hold)
+	require.Len(t, released, 1)
+	assert.Equal(t, "b", released[0].value)
+	assert.Len(t, released[0].held, 1)
+	assert.Empty(t, tenants.due(now.Add(time.Hour), true))
+
+	// Without root span the spans are not held after the decision wait
+	other := pcommon.TraceID([16]byte{2})
+	_, hold, _ = tenants.decide(other, "c", false, now)
+	assert.True(t, hold)
+	_, hold, _ = tenants.decide(other, "d", false, now.Add(time.Minute))
+	assert.False(t, hold)
+}
+
+func TestTraceTenantsDue(t *testing.T) {
+	now := time.Now()
+	tenants := newTestTraceTenants(t, &TraceConsistencyConfig{DecisionWait: time.Minute})
+	first := pcommon.TraceID([16]byte{1})
+	second := pcommon.TraceID([16]byte{2})
+	tenants.decide(first, "a", false, now)
+	tenants.hold(first, newTestHeld(first, "a"))
+	tenants.decide(second, "b", false, now.Add(30*time.Second))
+	tenants.hold(second, newTestHeld(second, "b"))
+
+	assert.Empty(t, tenants.due(now.Add(59*time.Second), false))
+	released := tenants.due(now.Add(time.Minute), false)
+	require.Len(t, released, 1)
+	assert.Equal(t, "a", released[0].value)
+	// All the held spans are released at shutdown
+	released = tenants.due(now, true)
+	require.Len(t, released, 1)
+	assert.Equal(t, "b", released[0].value)
+	assert.Empty(t, tenants.due(now.Add(time.Hour), true))
+}
+
+func TestTraceTenantsEviction(t *testing.T) {
+	now := time.Now()
+	first := pcommon.TraceID([16]byte{1})
+	second := pcommon.TraceID([16]byte{2})
+
+	tenants := newTestTraceTenants(t, &TraceConsistencyConfig{MaxTraces: 1, DecisionWait: time.Minute})
+	tenants.decide(first, "a", false, now)
+	tenants.hold(first, newTestHeld(first, "a"))
+	_, _, released := tenants.decide(second, "b", true, now)
+	require.Len(t, released, 1)
+	assert.Equal(t, "a", released[0].value)
+	// The trace was forgotten, the spans are released
+	released = tenants.hold(first, newTestHeld(first, "a"))
+	require.Len(t, released, 1)
+	assert.Equal(t, "a", released[0].value)
+	value, _, _ := tenants.decide(first, "c", true, now)
+	assert.Equal(t, "c", value)
+
+	tenants = newTestTraceTenants(t, &TraceConsistencyConfig{TTL: time.Minute})
+	tenants.decide(first, "a", true, now)
+	value, _, _ = tenants.decide(first, "b", true, now.Add(time.Minute))
+	assert.Equal(t, "b", value)
+}
+
+func TestTraceTenantsRunShortWait(t *testing.T) {
+	tenants := newTestTraceTenants(t, &TraceConsistencyConfig{DecisionWait: time.Nanosecond})
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		tenants.run(ctx, func(release) {})
+		close(done)
+	}()
+	cancel()
+	<-done
+}
+
+func TestTracesReassignGuards(t *testing.T) {
+	key := "x-scope-orgid"
+	ar := NewActionsRunner()
+	guard, err := newCardinalityGuard(processortest.NewNopSettings().Logger, newTestMeter(), newTestProcessorID(),
+		CardinalityLimitConfig{Key: key, MaxValues: 1})
+	require.NoError(t, err)
+	ar.addGuardAction(guard)
+	ctx := client.NewContext(context.Background(), client.Info{
+		Metadata: client.NewMetadata(map[string][]string{key: {"a"}}),
+	})
+	exc, err := ar.run(ctx, pcommon.NewMap(), sourceValues{})
+	require.NoError(t, err)
+	exc.setContextKey(key, []string{"a"})
+	guard.execute(exc)
+
+	reassigned := ar.reassign(ctx, exc, pcommon.NewMap(), key, "b")
+	values, _ := reassigned.getContextKey(key)
+	assert.Equal(t, []string{defaultOverflowValue}, values)
+}
+
+func TestTracesShutdownReleasesHeld(t *testing.T) {
+	key := "x-scope-orgid"
+	cfg := &Config{
+		ActionsConfig:    []ActionConfig{{Key: &key, Action: UPSERT, FromAttribute: AttributeNames{"tenant"}}},
+		TraceConsistency: &TraceConsistencyConfig{MetadataKey: key, DecisionWait: time.Hour},
+	}
+	require.NoError(t, cfg.Validate())
+	sink := &consumertest.TracesSink{}
+	p, err := NewContextTracesProcessor(processortest.NewNopSettings(), sink, trace.WithAttributes(), cfg)
+	require.NoError(t, err)
+	require.NoError(t, p.Start(context.Background(), componenttest.NewNopHost()))
+
+	td := ptrace.NewTraces()
+	rs := td.ResourceSpans().AppendEmpty()
+	rs.Resource().Attributes().PutStr("tenant", "team-a")
+	span := rs.ScopeSpans().AppendEmpty().Spans().AppendEmpty()
+	span.SetTraceID(pcommon.TraceID([16]byte{1}))
+	span.SetParentSpanID(pcommon.SpanID([8]byte{1}))
+	require.NoError(t, p.ConsumeTraces(context.Background(), td))
+	assert.Zero(t, sink.SpanCount())
+
+	require.NoError(t, p.Shutdown(context.Background()))
+	assert.Equal(t, 1, sink.SpanCount())
+}
+
+// testTracesSink records the traces and the contexts of the calls
+type testTracesSink struct {
+	mutex    sync.Mutex
+	contexts []context.Context
+	traces   []ptrace.Traces
+}
+
+func (s *testTracesSink) Capabilities() consumer.Capabilities {
+	return consumer.Capabilities{}
+}
+
+func (s *testTracesSink) ConsumeTraces(ctx context.Context, td ptrace.Traces) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.contexts = append(s.contexts, ctx)
+	s.traces = append(s.traces, td)
+	return nil
+}
+
+func TestTracesReassignCredentials(t *testing.T) {
+	key := "x-scope-orgid"
+	t.Setenv("TEAM_A_TOKEN", "secret-of-a")
+	cfg := &Config{
+		ActionsConfig:    []ActionConfig{{Key: &key, Action: UPSERT, FromAttribute: AttributeNames{"tenant"}}},
+		TraceConsistency: &TraceConsistencyConfig{MetadataKey: key},
+		Credentials: &CredentialsConfig{
+			MetadataKey: key,
+			Env:         map[string]CredentialsEnv{"team-a": {BearerToken: "TEAM_A_TOKEN"}},
+		},
+	}
+	require.NoError(t, cfg.Validate())
+	sink := &testTracesSink{}
+	p, err := NewContextTracesProcessor(processortest.NewNopSettings(), sink, trace.WithAttributes(), cfg)
+	require.NoError(t, err)
+	require.NoError(t, p.Start(context.Background(), componenttest.NewNopHost()))
+	defer func() { require.NoError(t, p.Shutdown(context.Background())) }()
+
+	newTraces := func(tenant string, spans ...ptrace.Span) ptrace.Traces {
+		td := ptrace.NewTraces()
+		rs := td.ResourceSpans().AppendEmpty()
+		rs.Resource().Attributes().PutStr("tenant", tenant)
+		for _, span := range spans {
+			span.CopyTo(rs.ScopeSpans().AppendEmpty().Spans().AppendEmpty())
+		}
+		return td
+	}
+	newSpan := func(traceID byte, root bool) ptrace.Span {
+		span := ptrace.NewSpan()
+		span.SetTraceID(pcommon.TraceID([16]byte{traceID}))
+		if !root {
+			span.SetParentSpanID(pcommon.SpanID([8]byte{1}))
+		}
+		return span
+	}
+	// The root span of the first trace decides team-b
+	require.NoError(t, p.ConsumeTraces(context.Background(), newTraces("team-b", newSpan(1, true))))
+	// The span of team-a is sent with its credentials, the span of the first
+	// trace is moved to team-b without them
+	require.NoError(t, p.ConsumeTraces(context.Background(), newTraces("team-a", newSpan(2, true), newSpan(1, false))))
+
+	require.Len(t, sink.contexts, 3)
+	for i, ctx := range sink.contexts {
+		metadata := client.FromContext(ctx).Metadata
+		traceID := sink.traces[i].ResourceSpans().At(0).ScopeSpans().At(0).Spans().At(0).TraceID()
+		if traceID == pcommon.TraceID([16]byte{2}) {
+			assert.Equal(t, []string{"team-a"}, metadata.Get(key))
+			assert.Equal(t, []string{"Bearer secret-of-a"}, metadata.Get("authorization"))
+			continue
+		}
+		assert.Equal(t, []string{"team-b"}, metadata.Get(key))
+		assert.Empty(t, metadata.Get("authorization"), i)
+	}
+}
@@ -0,0 +1,98 @@
+package contextprocessor
+
+import (
+	"context"
+	"strings"
+	"sync"
+
+	"go.opentelemetry.io/collector/client"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.uber.org/zap"
+)
+
+// usageRecorder counts the items and bytes forwarded per set of metadata values
+type usageRecorder struct {
+	logger         *zap.Logger
+	keys           []string
+	maxCardinality int
+	processor      attribute.KeyValue
+	signal         attribute.KeyValue
+	items          metric.Int64Counter
+	bytes          metric.Int64Counter
+	overflow       attribute.Set
+	mu             sync.Mutex
+	seen           map[attribute.Distinct]struct{}
+}
+
+func newUsageRecorder(
+	logger *zap.Logger,
+	meter metric.Meter,
+	processor attribute.KeyValue,
+	signal string,
+	cfg UsageConfig) (*usageRecorder, error) {
+
+	items, err := meter.Int64Counter(
+		"processor_context_usage_"+signal,
+		metric.WithDescription("Number of "+strings.ReplaceAll(signal, "_", " ")+" forwarded per metadata values"),
+		metric.WithUnit("{"+signal+"}"),
+	)
+	if err != nil {
+		return nil, err
+	}
+	bytes, err := meter.Int64Counter(
+		"processor_context_usage_bytes",
+		metric.WithDescription("Approximate size in bytes of the data forwarded per metadata values"),
+		metric.WithUnit("By"),
+	)
+	if err != nil {
+		return nil, err
+	}
+	// The bytes are counted by all the signals, the signal tells them apart
+	signalAttr := attribute.String("signal", signal)
+	overflow := make([]attribute.KeyValue, 0, len(cfg.MetadataKeys)+2)
+	overflow = append(overflow, processor, signalAttr)
+	for _, key := range cfg.MetadataKeys {
+		overflow = append(overflow, attribute.String(key, defaultOverflowValue))
+	}
+	return &usageRecorder{
+		logger:         logger,
+		keys:           cfg.MetadataKeys,
+		maxCardinality: cfg.MaxCardinality,
+		processor:      processor,
+		signal:         signalAttr,
+		items:          items,
+		bytes:          bytes,
+		overflow:       attribute.NewSet(overflow...),
+		seen:           make(map[attribute.Distinct]struct{}),
+	}, nil
+}
+
+// attributes returns the set of labels for the metadata in the context,
+// or the overflow set when there are too many different ones
+func (u *usageRecorder) attributes(ctx context.Context) attribute.Set {
+	info := client.FromContext(ctx)
+	attrs := make([]attribute.KeyValue, 0, len(u.keys)+2)
+	attrs = append(attrs, u.processor, u.signal)
+	for _, key := range u.keys {
+		attrs = append(attrs, attribute.String(key, strings.Join(info.Metadata.Get(key), ",")))
+	}
+	set := attribute.NewSet(attrs...)
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if _, exists := u.seen[set.Equivalent()]; exists {
+		return set
+	}
+	if u.maxCardinality > 0 && len(u.seen) >= u.maxCardinality {
+		u.logger.Debug("Usage metrics cardinality limit reached", zap.Int("max_cardinality", u.maxCardinality))
+		return u.overflow
+	}
+	u.seen[set.Equivalent()] = struct{}{}
+	return set
+}
+
+func (u *usageRecorder) record(ctx context.Context, items, bytes int) {
+	attrs := metric.WithAttributeSet(u.attributes(ctx))
+	u.items.Add(ctx, int64(items), attrs)
+	u.bytes.Add(ctx, int64(bytes), attrs)
+}
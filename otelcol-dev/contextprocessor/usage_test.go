@@ -0,0 +1,54 @@
+package contextprocessor
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/collector/client"
+	"go.opentelemetry.io/otel/attribute"
+	"go.uber.org/zap"
+)
+
+func TestUsageRecorderOverflow(t *testing.T) {
+	meter, reader := newTestMetricReader()
+	usage, err := newUsageRecorder(zap.NewNop(), meter, newTestProcessorID(), "spans", UsageConfig{
+		MetadataKeys:   []string{"x-scope-orgid", "x-team"},
+		MaxCardinality: 1,
+	})
+	require.NoError(t, err)
+	for _, tenant := range []string{"team-a", "team-b", "team-a"} {
+		ctx := client.NewContext(context.Background(), client.Info{
+			Metadata: client.NewMetadata(map[string][]string{"x-scope-orgid": {tenant}, "x-team": {"shop"}}),
+		})
+		usage.record(ctx, 1, 10)
+	}
+
+	team := attribute.NewSet(
+		newTestProcessorID(),
+		attribute.String("signal", "spans"),
+		attribute.String("x-scope-orgid", "team-a"),
+		attribute.String("x-team", "shop"),
+	)
+	overflow := attribute.NewSet(
+		newTestProcessorID(),
+		attribute.String("signal", "spans"),
+		attribute.String("x-scope-orgid", defaultOverflowValue),
+		attribute.String("x-team", defaultOverflowValue),
+	)
+	for name, value := range map[string]int64{"processor_context_usage_spans": 1, "processor_context_usage_bytes": 10} {
+		points := collectSum(t, reader, name)
+		require.Len(t, points, 2, name)
+		for _, point := range points {
+			switch {
+			case point.Attributes.Equals(&team):
+				assert.Equal(t, 2*value, point.Value, name)
+			case point.Attributes.Equals(&overflow):
+				assert.Equal(t, value, point.Value, name)
+			default:
+				t.Errorf("unexpected labels of %s: %s", name, point.Attributes.Encoded(attribute.DefaultEncoder()))
+			}
+		}
+	}
+}
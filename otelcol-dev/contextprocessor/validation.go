@@ -0,0 +1,106 @@
+package contextprocessor
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"go.opentelemetry.io/collector/consumer/consumererror"
+)
+
+// valueValidator checks the values against the permitted ones
+type valueValidator struct {
+	key       string
+	allow     map[string]struct{}
+	deny      map[string]struct{}
+	regex     *regexp.Regexp
+	onInvalid InvalidPolicy
+	fallback  string
+}
+
+// reads a file with a value per line, ignoring empty lines and comments
+func readValuesFile(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	values := make([]string, 0)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		values = append(values, line)
+	}
+	return values, scanner.Err()
+}
+
+func newValueValidator(key string, cfg *ValidationConfig) (*valueValidator, error) {
+	v := &valueValidator{
+		key:       key,
+		deny:      make(map[string]struct{}, len(cfg.Deny)),
+		onInvalid: cfg.OnInvalid,
+	}
+	if cfg.Fallback != nil {
+		v.fallback = *cfg.Fallback
+	}
+	for _, value := range cfg.Deny {
+		v.deny[value] = struct{}{}
+	}
+	allow := cfg.Allow
+	if cfg.File != "" {
+		values, err := readValuesFile(cfg.File)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read validation file: %w", err)
+		}
+		allow = append(allow, values...)
+	}
+	if cfg.File != "" || len(allow) > 0 {
+		v.allow = make(map[string]struct{}, len(allow))
+		for _, value := range allow {
+			v.allow[value] = struct{}{}
+		}
+	}
+	if cfg.Regex != "" {
+		regex, err := regexp.Compile(cfg.Regex)
+		if err != nil {
+			return nil, err
+		}
+		v.regex = regex
+	}
+	return v, nil
+}
+
+func (v *valueValidator) isValid(value string) bool {
+	if _, denied := v.deny[value]; denied {
+		return false
+	}
+	if v.allow == nil && v.regex == nil {
+		return true
+	}
+	if _, allowed := v.allow[value]; allowed {
+		return true
+	}
+	return v.regex != nil && v.regex.MatchString(value)
+}
+
+// validate returns the value to use and true, or false when the data has to
+// be dropped or rejected, setting the error in the eventContext
+func (v *valueValidator) validate(eventContext *eventContext, value string) (string, bool) {
+	if v.isValid(value) {
+		return value, true
+	}
+	switch v.onInvalid {
+	case "", INVALID_FALLBACK:
+		return v.fallback, true
+	case INVALID_DROP:
+		eventContext.err = errDataDropped
+	default:
+		eventContext.err = consumererror.NewPermanent(fmt.Errorf("invalid value %q for metadata key %q", value, v.key))
+	}
+	return value, false
+}
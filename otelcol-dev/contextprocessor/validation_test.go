@@ -0,0 +1,143 @@
+package contextprocessor
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/collector/client"
+	"go.opentelemetry.io/collector/consumer/consumererror"
+)
+
+func TestValidationConfig(t *testing.T) {
+	fallback := "unknown"
+	tests := []struct {
+		name string
+		cfg  ValidationConfig
+		err  error
+	}{
+		{name: "default policy", cfg: ValidationConfig{Allow: []string{"a"}, Fallback: &fallback}},
+		{name: "default policy without fallback", cfg: ValidationConfig{Allow: []string{"a"}}, err: errMissingValidationFallback},
+		{name: "fallback without value", cfg: ValidationConfig{Allow: []string{"a"}, OnInvalid: INVALID_FALLBACK}, err: errMissingValidationFallback},
+		{name: "drop", cfg: ValidationConfig{Deny: []string{"a"}, OnInvalid: INVALID_DROP}},
+		{name: "reject", cfg: ValidationConfig{Regex: "^a", OnInvalid: INVALID_REJECT}},
+		{name: "unknown policy", cfg: ValidationConfig{Allow: []string{"a"}, OnInvalid: "ignore"}, err: errInvalidValidationPolicy},
+		{name: "no rules", cfg: ValidationConfig{OnInvalid: INVALID_DROP}, err: errMissingValidationRules},
+	}
+	for _, tt := range tests {
+		err := tt.cfg.Validate()
+		if tt.err == nil {
+			assert.NoError(t, err, tt.name)
+		} else {
+			assert.ErrorIs(t, err, tt.err, tt.name)
+		}
+	}
+	assert.Error(t, (&ValidationConfig{Regex: "(", OnInvalid: INVALID_DROP}).Validate())
+}
+
+func TestValueValidatorIsValid(t *testing.T) {
+	file := writeTestFile(t, "tenants.txt", []byte("# tenants\nteam-c\n\n  team-d  \n"))
+	tests := []struct {
+		name    string
+		cfg     ValidationConfig
+		valid   []string
+		invalid []string
+	}{
+		{
+			name:    "allow",
+			cfg:     ValidationConfig{Allow: []string{"team-a", "team-b"}},
+			valid:   []string{"team-a", "team-b"},
+			invalid: []string{"team-c", "", "Team-a"},
+		},
+		{
+			// Without allow, regex or file any value not denied is valid
+			name:    "deny",
+			cfg:     ValidationConfig{Deny: []string{"anonymous", ""}},
+			valid:   []string{"team-a", "team-z"},
+			invalid: []string{"anonymous", ""},
+		},
+		{
+			name:    "regex",
+			cfg:     ValidationConfig{Regex: "^team-[a-z]$"},
+			valid:   []string{"team-a"},
+			invalid: []string{"team-ab", "team"},
+		},
+		{
+			name:    "file",
+			cfg:     ValidationConfig{File: file},
+			valid:   []string{"team-c", "team-d"},
+			invalid: []string{"# tenants", "", "team-a"},
+		},
+		{
+			// A value is valid if it matches any of them, unless it is denied
+			name:    "all",
+			cfg:     ValidationConfig{Allow: []string{"team-a"}, Regex: "^svc-", File: file, Deny: []string{"team-d", "svc-admin"}},
+			valid:   []string{"team-a", "team-c", "svc-web"},
+			invalid: []string{"team-d", "svc-admin", "team-b"},
+		},
+	}
+	for _, tt := range tests {
+		v, err := newValueValidator("x-scope-orgid", &tt.cfg)
+		require.NoError(t, err, tt.name)
+		for _, value := range tt.valid {
+			assert.True(t, v.isValid(value), "%s %q", tt.name, value)
+		}
+		for _, value := range tt.invalid {
+			assert.False(t, v.isValid(value), "%s %q", tt.name, value)
+		}
+	}
+
+	// An empty file allows nothing
+	v, err := newValueValidator("x-scope-orgid", &ValidationConfig{File: writeTestFile(t, "empty.txt", nil)})
+	require.NoError(t, err)
+	assert.False(t, v.isValid("team-a"))
+	_, err = newValueValidator("x-scope-orgid", &ValidationConfig{File: file + ".missing"})
+	assert.Error(t, err)
+}
+
+func TestValidationPolicies(t *testing.T) {
+	key := "x-scope-orgid"
+	fallback := "unknown"
+	tests := []struct {
+		name      string
+		onInvalid InvalidPolicy
+		expected  []string
+		err       func(error) bool
+	}{
+		{name: "default", expected: []string{"unknown"}},
+		{name: "fallback", onInvalid: INVALID_FALLBACK, expected: []string{"unknown"}},
+		{name: "drop", onInvalid: INVALID_DROP, err: func(err error) bool { return err == errDataDropped }},
+		{name: "reject", onInvalid: INVALID_REJECT, err: consumererror.IsPermanent},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ar := NewActionsRunner()
+			require.NoError(t, ar.AddAction(ActionConfig{
+				Key:           &key,
+				Action:        UPSERT,
+				FromAttribute: AttributeNames{"tenant"},
+				Validation: &ValidationConfig{
+					Allow:     []string{"team-a"},
+					OnInvalid: tt.onInvalid,
+					Fallback:  &fallback,
+				},
+			}))
+			// Valid values are set
+			ctxs, err := ar.Apply(context.Background(), newTestAttributes(map[string]any{"tenant": "team-a"}))
+			require.NoError(t, err)
+			require.Len(t, ctxs, 1)
+			assert.Equal(t, []string{"team-a"}, client.FromContext(ctxs[0]).Metadata.Get(key))
+
+			ctxs, err = ar.Apply(context.Background(), newTestAttributes(map[string]any{"tenant": "team-typo"}))
+			if tt.err != nil {
+				require.Error(t, err)
+				assert.True(t, tt.err(err), err.Error())
+				return
+			}
+			require.NoError(t, err)
+			require.Len(t, ctxs, 1)
+			assert.Equal(t, tt.expected, client.FromContext(ctxs[0]).Metadata.Get(key))
+		})
+	}
+}
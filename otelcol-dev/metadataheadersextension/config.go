@@ -0,0 +1,40 @@
+package metadataheadersextension
+
+import (
+	"fmt"
+	"regexp"
+)
+
+var (
+	errMissingKeys = fmt.Errorf("missing 'keys_from' and/or 'keys'")
+)
+
+// Config represents the extension config settings within the collector's config.yaml
+type Config struct {
+	// KeysFrom is the metadata key with the list of keys to forward, set by the
+	// context processor with `publish_keys: true`
+	KeysFrom string `mapstructure:"keys_from"`
+	// Keys are forwarded if they are in the metadata, no matter the patterns
+	Keys []string `mapstructure:"keys"`
+	// Include are regular expressions, only the keys from KeysFrom matching
+	// any of them are forwarded. If empty, all the keys are included
+	Include []string `mapstructure:"include"`
+	// Exclude are regular expressions, the keys from KeysFrom matching any of
+	// them are not forwarded
+	Exclude []string `mapstructure:"exclude"`
+	// Renames maps metadata keys to the header names
+	Renames map[string]string `mapstructure:"renames"`
+}
+
+// Validate checks if the extension configuration is valid
+func (cfg *Config) Validate() error {
+	if cfg.KeysFrom == "" && len(cfg.Keys) == 0 {
+		return errMissingKeys
+	}
+	for _, pattern := range append(append([]string{}, cfg.Include...), cfg.Exclude...) {
+		if _, err := regexp.Compile(pattern); err != nil {
+			return fmt.Errorf("invalid pattern %q: %w", pattern, err)
+		}
+	}
+	return nil
+}
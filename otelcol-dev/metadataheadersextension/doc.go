@@ -0,0 +1,8 @@
+// Copyright The OpenTelemetry Authors
+// SPDX-License-Identifier: Apache-2.0
+
+//go:generate mdatagen metadata.yaml
+
+// Package metadataheadersextension implements an auth extension which sets
+// the context metadata as outgoing HTTP headers or gRPC metadata.
+package metadataheadersextension // import "github.com/jriguera/opentelemetry-collector-contrib/extension/metadataheadersextension"
@@ -0,0 +1,149 @@
+package metadataheadersextension
+
+import (
+	"context"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"go.opentelemetry.io/collector/client"
+	"google.golang.org/grpc/credentials"
+)
+
+// metadataHeaders selects the metadata keys of the context to forward
+type metadataHeaders struct {
+	keysFrom string
+	keys     []string
+	include  []*regexp.Regexp
+	exclude  []*regexp.Regexp
+	renames  map[string]string
+}
+
+func compilePatterns(patterns []string) ([]*regexp.Regexp, error) {
+	regexps := make([]*regexp.Regexp, 0, len(patterns))
+	for _, pattern := range patterns {
+		r, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, err
+		}
+		regexps = append(regexps, r)
+	}
+	return regexps, nil
+}
+
+func matchesAny(regexps []*regexp.Regexp, key string) bool {
+	for _, r := range regexps {
+		if r.MatchString(key) {
+			return true
+		}
+	}
+	return false
+}
+
+func newMetadataHeaders(cfg *Config) (*metadataHeaders, error) {
+	include, err := compilePatterns(cfg.Include)
+	if err != nil {
+		return nil, err
+	}
+	exclude, err := compilePatterns(cfg.Exclude)
+	if err != nil {
+		return nil, err
+	}
+	// Metadata keys are case-insensitive
+	renames := make(map[string]string, len(cfg.Renames))
+	for k, v := range cfg.Renames {
+		renames[strings.ToLower(k)] = v
+	}
+	return &metadataHeaders{
+		keysFrom: cfg.KeysFrom,
+		keys:     cfg.Keys,
+		include:  include,
+		exclude:  exclude,
+		renames:  renames,
+	}, nil
+}
+
+// headers returns the header names with their values from the metadata of the context
+func (mh *metadataHeaders) headers(ctx context.Context) map[string][]string {
+	metadata := client.FromContext(ctx).Metadata
+	keys := make([]string, 0, len(mh.keys))
+	keys = append(keys, mh.keys...)
+	if mh.keysFrom != "" {
+		for _, key := range metadata.Get(mh.keysFrom) {
+			if len(mh.include) > 0 && !matchesAny(mh.include, key) {
+				continue
+			}
+			if matchesAny(mh.exclude, key) {
+				continue
+			}
+			keys = append(keys, key)
+		}
+	}
+	headers := make(map[string][]string, len(keys))
+	for _, key := range keys {
+		values := metadata.Get(key)
+		if len(values) == 0 {
+			continue
+		}
+		name, exists := mh.renames[strings.ToLower(key)]
+		if !exists {
+			name = key
+		}
+		headers[name] = values
+	}
+	return headers
+}
+
+func (mh *metadataHeaders) roundTripper(base http.RoundTripper) (http.RoundTripper, error) {
+	return &headersRoundTripper{
+		base:    base,
+		headers: mh.headers,
+	}, nil
+}
+
+func (mh *metadataHeaders) perRPCCredentials() (credentials.PerRPCCredentials, error) {
+	return &headersPerRPC{
+		headers: mh.headers,
+	}, nil
+}
+
+// headersRoundTripper sets the headers in the HTTP requests
+type headersRoundTripper struct {
+	base    http.RoundTripper
+	headers func(context.Context) map[string][]string
+}
+
+func (h *headersRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	headers := h.headers(req.Context())
+	if len(headers) == 0 {
+		return h.base.RoundTrip(req)
+	}
+	// RoundTrip should not modify the request
+	newReq := req.Clone(req.Context())
+	for name, values := range headers {
+		newReq.Header.Del(name)
+		for _, value := range values {
+			newReq.Header.Add(name, value)
+		}
+	}
+	return h.base.RoundTrip(newReq)
+}
+
+// headersPerRPC sets the gRPC metadata, multiple values are joined with ","
+type headersPerRPC struct {
+	headers func(context.Context) map[string][]string
+}
+
+func (h *headersPerRPC) GetRequestMetadata(ctx context.Context, _ ...string) (map[string]string, error) {
+	headers := h.headers(ctx)
+	metadata := make(map[string]string, len(headers))
+	for name, values := range headers {
+		// gRPC metadata keys are lowercase
+		metadata[strings.ToLower(name)] = strings.Join(values, ",")
+	}
+	return metadata, nil
+}
+
+func (h *headersPerRPC) RequireTransportSecurity() bool {
+	return false
+}
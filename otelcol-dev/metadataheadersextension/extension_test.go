@@ -0,0 +1,162 @@
+package metadataheadersextension
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/collector/client"
+)
+
+func newTestContext(metadata map[string][]string) context.Context {
+	return client.NewContext(context.Background(), client.Info{Metadata: client.NewMetadata(metadata)})
+}
+
+func newTestHeaders(t *testing.T, cfg *Config) *metadataHeaders {
+	require.NoError(t, cfg.Validate())
+	mh, err := newMetadataHeaders(cfg)
+	require.NoError(t, err)
+	return mh
+}
+
+func TestHeaders(t *testing.T) {
+	metadata := map[string][]string{
+		"x-published":   {"X-Scope-OrgID", "x-team", "x-internal-id", "x-missing"},
+		"x-scope-orgid": {"team-a"},
+		"x-team":        {"shop", "web"},
+		"x-internal-id": {"42"},
+		"x-region":      {"eu"},
+	}
+	tests := []struct {
+		name     string
+		cfg      *Config
+		expected map[string][]string
+	}{
+		{
+			name: "keys",
+			cfg:  &Config{Keys: []string{"x-region", "X-Team", "x-missing"}},
+			expected: map[string][]string{
+				"x-region": {"eu"},
+				"X-Team":   {"shop", "web"},
+			},
+		},
+		{
+			name: "keys from",
+			cfg:  &Config{KeysFrom: "x-published"},
+			expected: map[string][]string{
+				"X-Scope-OrgID": {"team-a"},
+				"x-team":        {"shop", "web"},
+				"x-internal-id": {"42"},
+			},
+		},
+		{
+			name: "keys and keys from",
+			cfg:  &Config{KeysFrom: "X-Published", Keys: []string{"x-region"}, Include: []string{"^x-team$"}},
+			expected: map[string][]string{
+				"x-team":   {"shop", "web"},
+				"x-region": {"eu"},
+			},
+		},
+		{
+			name: "include and exclude",
+			cfg:  &Config{KeysFrom: "x-published", Include: []string{"^x-"}, Exclude: []string{"internal"}},
+			expected: map[string][]string{
+				"x-team": {"shop", "web"},
+			},
+		},
+		{
+			// The patterns only apply to keys_from
+			name: "exclude keys",
+			cfg:  &Config{Keys: []string{"x-internal-id"}, Exclude: []string{"internal"}},
+			expected: map[string][]string{
+				"x-internal-id": {"42"},
+			},
+		},
+		{
+			name: "renames",
+			cfg: &Config{
+				Keys:    []string{"X-Scope-OrgID", "x-team"},
+				Renames: map[string]string{"x-scope-orgid": "X-Scope-OrgID", "X-TEAM": "X-Grafana-Team"},
+			},
+			expected: map[string][]string{
+				"X-Scope-OrgID":  {"team-a"},
+				"X-Grafana-Team": {"shop", "web"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mh := newTestHeaders(t, tt.cfg)
+			assert.Equal(t, tt.expected, mh.headers(newTestContext(metadata)))
+		})
+	}
+}
+
+// testRoundTripper records the request
+type testRoundTripper struct {
+	req *http.Request
+}
+
+func (rt *testRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	rt.req = req
+	return &http.Response{StatusCode: http.StatusOK}, nil
+}
+
+func TestRoundTrip(t *testing.T) {
+	mh := newTestHeaders(t, &Config{
+		Keys:    []string{"x-scope-orgid", "x-team"},
+		Renames: map[string]string{"x-scope-orgid": "X-Scope-OrgID"},
+	})
+	base := &testRoundTripper{}
+	rt, err := mh.roundTripper(base)
+	require.NoError(t, err)
+
+	ctx := newTestContext(map[string][]string{"x-scope-orgid": {"team-a"}, "x-team": {"shop", "web"}})
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, "http://localhost/otlp", nil)
+	require.NoError(t, err)
+	req.Header.Set("X-Scope-OrgID", "anonymous")
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	_, err = rt.RoundTrip(req)
+	require.NoError(t, err)
+
+	require.NotSame(t, req, base.req)
+	assert.Equal(t, []string{"team-a"}, base.req.Header.Values("X-Scope-OrgID"))
+	assert.Equal(t, []string{"shop", "web"}, base.req.Header.Values("X-Team"))
+	assert.Equal(t, "application/x-protobuf", base.req.Header.Get("Content-Type"))
+	// The original request is not changed
+	assert.Equal(t, http.Header{
+		"X-Scope-Orgid": {"anonymous"},
+		"Content-Type":  {"application/x-protobuf"},
+	}, req.Header)
+
+	// Without headers the request is sent as it is
+	req, err = http.NewRequestWithContext(context.Background(), http.MethodPost, "http://localhost/otlp", nil)
+	require.NoError(t, err)
+	_, err = rt.RoundTrip(req)
+	require.NoError(t, err)
+	assert.Same(t, req, base.req)
+}
+
+func TestGetRequestMetadata(t *testing.T) {
+	mh := newTestHeaders(t, &Config{
+		Keys:    []string{"x-scope-orgid", "x-team"},
+		Renames: map[string]string{"x-scope-orgid": "X-Scope-OrgID"},
+	})
+	creds, err := mh.perRPCCredentials()
+	require.NoError(t, err)
+	assert.False(t, creds.RequireTransportSecurity())
+
+	ctx := newTestContext(map[string][]string{"x-scope-orgid": {"team-a"}, "x-team": {"shop", "web"}})
+	metadata, err := creds.GetRequestMetadata(ctx, "http://localhost")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		"x-scope-orgid": "team-a",
+		"x-team":        "shop,web",
+	}, metadata)
+
+	metadata, err = creds.GetRequestMetadata(context.Background())
+	require.NoError(t, err)
+	assert.Empty(t, metadata)
+}
@@ -0,0 +1,49 @@
+package metadataheadersextension
+
+import (
+	"context"
+
+	"go.opentelemetry.io/collector/component"
+	"go.opentelemetry.io/collector/extension"
+	"go.opentelemetry.io/collector/extension/auth"
+)
+
+var (
+	cfgType = component.MustNewType("metadata_headers")
+)
+
+const (
+	// Metadata key set by the context processor with the list of keys
+	defaultKeysFrom = "context-metadata-keys"
+)
+
+func createDefaultConfig() component.Config {
+	return &Config{
+		KeysFrom: defaultKeysFrom,
+	}
+}
+
+// NewFactory returns a new factory for the metadata headers extension.
+func NewFactory() extension.Factory {
+	return extension.NewFactory(
+		cfgType,
+		createDefaultConfig,
+		createExtension,
+		component.StabilityLevelAlpha,
+	)
+}
+
+func createExtension(
+	_ context.Context,
+	_ extension.Settings,
+	cfg component.Config) (extension.Extension, error) {
+
+	headers, err := newMetadataHeaders(cfg.(*Config))
+	if err != nil {
+		return nil, err
+	}
+	return auth.NewClient(
+		auth.WithClientRoundTripper(headers.roundTripper),
+		auth.WithClientPerRPCCredentials(headers.perRPCCredentials),
+	), nil
+}